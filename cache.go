@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// MetadataCacheVersion is the current version of the cache file format.
+	// Caches with a different version are discarded.
+	MetadataCacheVersion = 3
+
+	// DefaultMetadataCacheFile is the name of the cache file in the user cache directory.
+	DefaultMetadataCacheFile = "metadata.json"
+)
+
+// DefaultMetadataCachePath returns the default cache path.
+func DefaultMetadataCachePath() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "image-rename", DefaultMetadataCacheFile)
+}
+
+// MetadataCacheKey identifies a version of a file.
+type MetadataCacheKey struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	Inode   uint64 `json:"inode"`
+	Hash    string `json:"hash,omitempty"`
+}
+
+// NewMetadataCacheKey returns a cache key for file info, and optionally a
+// content hash of the file.
+func NewMetadataCacheKey(filePath string, info os.FileInfo, withHash bool) (MetadataCacheKey, error) {
+	key := MetadataCacheKey{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Inode:   FileInode(info),
+	}
+	if withHash {
+		hash, err := HashFile(filePath)
+		if err != nil {
+			return key, err
+		}
+		key.Hash = hash
+	}
+	return key, nil
+}
+
+// MetadataCacheEntry is the cached metadata for a file.
+type MetadataCacheEntry struct {
+	Key       MetadataCacheKey `json:"key"`
+	Exif      ExifTags         `json:"exif,omitempty"`
+	ErrorKind ErrorKind        `json:"error_kind,omitempty"`
+	ErrorTag  string           `json:"error_tag,omitempty"`
+	Error     string           `json:"error,omitempty"`
+
+	// PerceptualHash is set once the perceptual hash has been computed.
+	PerceptualHash *uint64 `json:"perceptual_hash,omitempty"`
+}
+
+// Err returns the cached error for the entry, if any.
+func (mce *MetadataCacheEntry) Err(filePath string) error {
+	if len(mce.ErrorKind) == 0 {
+		return nil
+	}
+	return NewFileError(mce.ErrorKind, filePath, mce.ErrorTag, errors.New(mce.Error))
+}
+
+// NewMetadataCache returns a new, empty metadata cache.
+func NewMetadataCache(path string, withHash bool) *MetadataCache {
+	return &MetadataCache{
+		Path:     path,
+		WithHash: withHash,
+		Version:  MetadataCacheVersion,
+		Entries:  map[string]*MetadataCacheEntry{},
+	}
+}
+
+// ReadMetadataCache reads a metadata cache from a path, returning an empty
+// cache if the file does not exist or is from a different version. A corrupt
+// cache is logged and replaced by an empty one.
+func ReadMetadataCache(path string, withHash bool) (*MetadataCache, error) {
+	cache := NewMetadataCache(path, withHash)
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored MetadataCache
+	if err = json.Unmarshal(contents, &stored); err != nil {
+		log.Printf("cache: %s is corrupt and will be rebuilt: %v", path, err)
+		return cache, nil
+	}
+	if stored.Version == MetadataCacheVersion && stored.Entries != nil {
+		cache.Entries = stored.Entries
+	}
+	return cache, nil
+}
+
+// MetadataCache persists the metadata extracted from files between runs.
+// Entries are keyed by absolute path and are valid while the file's size,
+// modification time, inode and (optionally) content hash are unchanged.
+type MetadataCache struct {
+	Path     string                         `json:"-"`
+	WithHash bool                           `json:"-"`
+	Version  int                            `json:"version"`
+	Entries  map[string]*MetadataCacheEntry `json:"entries"`
+	Hits     int                            `json:"-"`
+	Misses   int                            `json:"-"`
+
+	lock  sync.Mutex
+	dirty bool
+}
+
+// Get returns the cached metadata for a file if it is still valid.
+func (mc *MetadataCache) Get(filePath string, key MetadataCacheKey) (*MetadataCacheEntry, bool) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	entry, hasEntry := mc.Entries[filePath]
+	if !hasEntry || entry.Key != key {
+		mc.Misses++
+		return nil, false
+	}
+	mc.Hits++
+	return entry, true
+}
+
+// Put stores the metadata for a file.
+func (mc *MetadataCache) Put(filePath string, key MetadataCacheKey, exifTags ExifTags, err error) {
+	entry := &MetadataCacheEntry{Key: key, Exif: exifTags}
+	if err != nil {
+		entry.ErrorKind = ErrorKindOf(err)
+		if typed, isTyped := err.(*FileError); isTyped {
+			entry.ErrorTag = typed.Tag
+			entry.Error = typed.Err.Error()
+		} else {
+			entry.Error = err.Error()
+		}
+	}
+
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	mc.Entries[filePath] = entry
+	mc.dirty = true
+}
+
+// PerceptualHash returns the cached perceptual hash for a file. It should
+// only be called for files whose entry was validated with Get during this run.
+func (mc *MetadataCache) PerceptualHash(filePath string) (uint64, bool) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	if entry, hasEntry := mc.Entries[filePath]; hasEntry && entry.PerceptualHash != nil {
+		return *entry.PerceptualHash, true
+	}
+	return 0, false
+}
+
+// PutPerceptualHash stores the perceptual hash for a file with an existing entry.
+func (mc *MetadataCache) PutPerceptualHash(filePath string, hash uint64) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	if entry, hasEntry := mc.Entries[filePath]; hasEntry {
+		entry.PerceptualHash = &hash
+		mc.dirty = true
+	}
+}
+
+// Prune removes entries for files that no longer exist or have changed,
+// returning the number of entries removed.
+func (mc *MetadataCache) Prune() int {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	var removed int
+	for filePath, entry := range mc.Entries {
+		if !mc.isCurrent(filePath, entry) {
+			delete(mc.Entries, filePath)
+			removed++
+		}
+	}
+	if removed > 0 {
+		mc.dirty = true
+	}
+	return removed
+}
+
+// Stats returns statistics about the cache.
+func (mc *MetadataCache) Stats() MetadataCacheStats {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	stats := MetadataCacheStats{Path: mc.Path, Entries: len(mc.Entries)}
+	if info, err := os.Stat(mc.Path); err == nil {
+		stats.Size = info.Size()
+		stats.ModTime = info.ModTime()
+	}
+	for filePath, entry := range mc.Entries {
+		if !mc.isCurrent(filePath, entry) {
+			stats.Stale++
+		}
+		if len(entry.ErrorKind) > 0 {
+			stats.Errors++
+		}
+	}
+	return stats
+}
+
+// Save writes the cache to disk if it has changed.
+func (mc *MetadataCache) Save() error {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	if !mc.dirty {
+		return nil
+	}
+	contents, err := json.Marshal(mc)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(mc.Path), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so an interrupted save can't corrupt the
+	// cache; it is unique so concurrent saves don't write to the same file.
+	temp, err := ioutil.TempFile(filepath.Dir(mc.Path), "."+filepath.Base(mc.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(contents)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), mc.Path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	mc.dirty = false
+	return nil
+}
+
+func (mc *MetadataCache) isCurrent(filePath string, entry *MetadataCacheEntry) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+	key, err := NewMetadataCacheKey(filePath, info, len(entry.Key.Hash) > 0)
+	if err != nil {
+		return false
+	}
+	return key == entry.Key
+}
+
+// MetadataCacheStats are statistics about a metadata cache.
+type MetadataCacheStats struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Entries int
+	Stale   int
+	Errors  int
+}
+
+// WriteTo writes the stats to a given writer.
+func (mcs MetadataCacheStats) WriteTo(w io.Writer) (int64, error) {
+	n, err := fmt.Fprintf(w, "path:    %s\nsize:    %d bytes\nentries: %d\nstale:   %d\nerrors:  %d\n", mcs.Path, mcs.Size, mcs.Entries, mcs.Stale, mcs.Errors)
+	return int64(n), err
+}
+
+// HashFile returns the hex encoded sha-256 of a file's contents.
+func HashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestMetadataCacheRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(tempDir)
+
+	imagePath := filepath.Join(tempDir, "a.jpg")
+	assert.Nil(ioutil.WriteFile(imagePath, []byte("not really a jpeg"), 0644))
+	info, err := os.Stat(imagePath)
+	assert.Nil(err)
+
+	key, err := NewMetadataCacheKey(imagePath, info, true)
+	assert.Nil(err)
+	assert.NotEmpty(key.Hash)
+
+	cachePath := filepath.Join(tempDir, "cache", "metadata.json")
+	cache := NewMetadataCache(cachePath, true)
+	cache.Put(imagePath, key, ExifTags{"Make": "Canon"}, nil)
+	cache.Put(filepath.Join(tempDir, "b.jpg"), key, nil, NewFileError(ErrorKindNoExif, "", "", fmt.Errorf("test")))
+	assert.Nil(cache.Save())
+
+	loaded, err := ReadMetadataCache(cachePath, true)
+	assert.Nil(err)
+	assert.Len(loaded.Entries, 2)
+
+	entry, hasEntry := loaded.Get(imagePath, key)
+	assert.True(hasEntry)
+	assert.Equal("Canon", entry.Exif["Make"])
+	assert.Nil(entry.Err(imagePath))
+
+	errored, hasEntry := loaded.Get(filepath.Join(tempDir, "b.jpg"), key)
+	assert.True(hasEntry)
+	assert.True(IsNoExifError(errored.Err("b.jpg")))
+
+	key.Size++
+	_, hasEntry = loaded.Get(imagePath, key)
+	assert.False(hasEntry)
+	assert.Equal(2, loaded.Hits)
+	assert.Equal(1, loaded.Misses)
+}
+
+func TestMetadataCachePrune(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(tempDir)
+
+	imagePath := filepath.Join(tempDir, "a.jpg")
+	assert.Nil(ioutil.WriteFile(imagePath, []byte("contents"), 0644))
+	info, err := os.Stat(imagePath)
+	assert.Nil(err)
+	key, err := NewMetadataCacheKey(imagePath, info, false)
+	assert.Nil(err)
+
+	cache := NewMetadataCache(filepath.Join(tempDir, "metadata.json"), false)
+	cache.Put(imagePath, key, ExifTags{}, nil)
+	cache.Put(filepath.Join(tempDir, "missing.jpg"), key, ExifTags{}, nil)
+
+	stats := cache.Stats()
+	assert.Equal(2, stats.Entries)
+	assert.Equal(1, stats.Stale)
+
+	assert.Equal(1, cache.Prune())
+	assert.Len(cache.Entries, 1)
+}
+
+func TestReadMetadataCacheMissing(t *testing.T) {
+	assert := assert.New(t)
+
+	cache, err := ReadMetadataCache(filepath.Join(os.TempDir(), "image-rename-does-not-exist.json"), false)
+	assert.Nil(err)
+	assert.Empty(cache.Entries)
+}
+
+func TestReadMetadataCacheCorrupt(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "metadata.json")
+	assert.Nil(ioutil.WriteFile(cachePath, []byte(`{"version": 1, "entries": {"/a.jpg": {`), 0644))
+
+	cache, err := ReadMetadataCache(cachePath, false)
+	assert.Nil(err)
+	assert.Empty(cache.Entries)
+
+	cache.Put("/a.jpg", MetadataCacheKey{Size: 1}, ExifTags{"Make": "Canon"}, nil)
+	assert.Nil(cache.Save())
+	cache, err = ReadMetadataCache(cachePath, false)
+	assert.Nil(err)
+	assert.Len(cache.Entries, 1)
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(err)
+	assert.Len(files, 1)
+}
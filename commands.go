@@ -0,0 +1,612 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// flag groups
+var (
+	configFlags   = []string{"config", "profile"}
+	inputFlags    = []string{"workdir", "filter", "include", "exclude", "type", "sniff", "where", "recursive", "jobs", "cache", "cache-hash", "no-cache"}
+	outputFlags   = []string{"output", "dest"}
+	groupingFlags = []string{"similar", "similar-threshold", "sequence-gap", "event-gap", "event-distance", "events", "lookup"}
+	renameFlags   = []string{"template", "script", "plugin", "plugin-timeout", "dryrun", "duplicates", "yes", "continue", "counters", "renumber", "on-error"}
+)
+
+// Command is a subcommand of the command line.
+type Command struct {
+	Name        string
+	Args        string
+	Description string
+	Flags       []string
+	Run         func(args []string) (int, error)
+}
+
+// commands are the subcommands; the first is run when no subcommand is given.
+var commands = []*Command{
+	{
+		Name:        "rename",
+		Description: "Rename the files in the working directory by the output format.",
+		Flags:       flagGroups(configFlags, inputFlags, outputFlags, groupingFlags, renameFlags),
+		Run:         runRenameCommand,
+	},
+	{
+		Name:        "plan",
+		Description: "Write the renames that `rename` would run as json to stdout, to be run later by `apply`.",
+		Flags:       flagGroups(configFlags, inputFlags, outputFlags, groupingFlags, []string{"template", "script", "plugin", "plugin-timeout", "continue", "counters", "renumber", "on-error"}),
+		Run:         runPlanCommand,
+	},
+	{
+		Name:        "apply",
+		Args:        "PLAN",
+		Description: "Run the renames of a plan written by `plan`; use `-` to read the plan from stdin.",
+		Flags:       flagGroups(configFlags, []string{"workdir", "dryrun", "on-error"}),
+		Run:         runApplyCommand,
+	},
+	{
+		Name:        "undo",
+		Description: "Reverse the renames of the last run in the working directory; run it again to redo them.",
+		Flags:       flagGroups(configFlags, []string{"workdir", "dryrun", "on-error"}),
+		Run:         runUndoCommand,
+	},
+	{
+		Name:        "inspect",
+		Args:        "FILE...",
+		Description: "Print every tag of files, with the value it renders.",
+		Flags:       flagGroups(configFlags, groupingFlags, []string{"format", "jobs", "cache", "cache-hash", "no-cache"}),
+		Run:         runInspectCommand,
+	},
+	{
+		Name:        "verify",
+		Description: "Check that the names of the files in the working directory match the output format and their exif data.",
+		Flags:       flagGroups(configFlags, inputFlags, outputFlags),
+		Run:         runVerifyCommand,
+	},
+	{
+		Name:        "import",
+		Args:        "SOURCE",
+		Description: "Move the files in a source directory, like a memory card, into the --dest directory by the output format.",
+		Flags:       flagGroups(configFlags, inputFlags, outputFlags, groupingFlags, renameFlags),
+		Run:         runImportCommand,
+	},
+	{
+		Name:        "watch",
+		Description: "Rename new files in the working directory as they arrive, once they stop changing.",
+		Flags:       flagGroups(configFlags, inputFlags, outputFlags, groupingFlags, renameFlags, []string{"interval"}),
+		Run:         runWatchCommand,
+	},
+	{
+		Name:        "tags",
+		Description: "List the tags that can be used in the output format.",
+		Run:         runTagsCommand,
+	},
+	{
+		Name:        "cache",
+		Args:        "prune|stats",
+		Description: "Remove stale entries from the metadata cache, or print its statistics.",
+		Flags:       flagGroups(configFlags, []string{"cache", "cache-hash"}),
+		Run:         runCacheCommand,
+	},
+}
+
+// flagGroups joins groups of flag names.
+func flagGroups(groups ...[]string) []string {
+	var names []string
+	for _, group := range groups {
+		names = append(names, group...)
+	}
+	return names
+}
+
+// FindCommand returns the command with a given name, or nil.
+func FindCommand(name string) *Command {
+	for _, command := range commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// FlagSet returns a flag set of the command's flags. The flags share their
+// values with every other command, so the `Args*` helpers read them.
+func (c *Command) FlagSet() *flag.FlagSet {
+	flagSet := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	names := append([]string{}, c.Flags...)
+	sort.Strings(names)
+	for _, name := range names {
+		f := allFlags.Lookup(name)
+		flagSet.Var(f.Value, f.Name, f.Usage)
+	}
+	flagSet.Usage = func() {
+		out := flagSet.Output()
+		fmt.Fprintf(out, "usage: image-rename %s [flags] %s\n\n%s\n", c.Name, c.Args, c.Description)
+		if len(names) > 0 {
+			fmt.Fprintf(out, "\nflags:\n")
+			flagSet.PrintDefaults()
+		}
+	}
+	return flagSet
+}
+
+// WriteUsage writes the list of commands.
+func WriteUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: image-rename [command] [flags] [arguments]\n\ncommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", command.Name, command.Description)
+	}
+	fmt.Fprintf(w, "\nThe default command is rename. Run `image-rename help <command>` for the flags of a command, and `image-rename --version` for the version.\n")
+}
+
+// RunCommandLine runs the command line, returning the exit code.
+func RunCommandLine(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "-version", "--version", "version":
+			{
+				fmt.Println(SemVer)
+				return ExitCodeOK
+			}
+		case "-h", "-help", "--help", "help":
+			{
+				if len(args) > 1 {
+					if command := FindCommand(args[1]); command != nil {
+						flagSet := command.FlagSet()
+						flagSet.SetOutput(os.Stdout)
+						flagSet.Usage()
+						return ExitCodeOK
+					}
+				}
+				WriteUsage(os.Stdout)
+				return ExitCodeOK
+			}
+		}
+	}
+
+	command := commands[0]
+	if len(args) > 0 {
+		if named := FindCommand(args[0]); named != nil {
+			command, args = named, args[1:]
+		}
+	}
+	flagSet := command.FlagSet()
+	if err := flagSet.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitCodeOK
+		}
+		return ExitCodeError
+	}
+	if err := applyConfig(flagSet); err != nil {
+		log.Println(err)
+		return ExitCodeError
+	}
+	exitCode, err := command.Run(flagSet.Args())
+	if err != nil {
+		log.Println(err)
+	}
+	return exitCode
+}
+
+// runRenameCommand runs the `rename` command.
+func runRenameCommand(args []string) (int, error) {
+	if len(args) > 0 {
+		return ExitCodeError, fmt.Errorf("rename: unexpected argument %q", args[0])
+	}
+	workDir, err := ArgsWorkDirAbsolute()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return renameFiles(workDir, nil)
+}
+
+// runImportCommand runs the `import` command.
+func runImportCommand(args []string) (int, error) {
+	if len(args) != 1 {
+		return ExitCodeError, fmt.Errorf("import: expected a source directory")
+	}
+	if len(ArgsDest()) == 0 {
+		return ExitCodeError, fmt.Errorf("import: --dest is required")
+	}
+	source, err := filepath.Abs(args[0])
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return renameFiles(source, nil)
+}
+
+// runPlanCommand runs the `plan` command.
+func runPlanCommand(args []string) (int, error) {
+	if len(args) > 0 {
+		return ExitCodeError, fmt.Errorf("plan: unexpected argument %q", args[0])
+	}
+	workDir, err := ArgsWorkDirAbsolute()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	plan := &RenamePlan{Renames: []RenameStep{}}
+	exitCode, err := renameFiles(workDir, plan)
+	if err != nil {
+		return exitCode, err
+	}
+	if _, err = plan.WriteTo(os.Stdout); err != nil {
+		return ExitCodeError, err
+	}
+	return exitCode, nil
+}
+
+// renameFiles renames the files in a directory, or adds the renames to a
+// plan if one is given, returning the exit code.
+func renameFiles(workDir string, plan *RenamePlan) (int, error) {
+	// a template replaces the output pattern, and is checked when it is parsed.
+	if len(ArgsTemplate()) == 0 {
+		if err := checkOutputPattern(ArgsOutputFilePattern()); err != nil {
+			return ExitCodeError, err
+		}
+	}
+	options, err := ArgsRenameOptions(workDir)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	options.Plan = plan
+	if err = recoverInterruptedRenames(options); err != nil {
+		return ExitCodeError, err
+	}
+
+	fileFilter, err := ArgsFileFilter()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	files, err := FilesInDirectoryWithFilter(workDir, fileFilter, options.DuplicatesDir)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	fileTags := ExtractFileOutputTags(options.OutputFilePattern)
+
+	if ArgsContinue() {
+		if _, err = SeedIndexes(options.Collector, options.OutputFilePattern, files, fileFilter, options.Cache); err != nil {
+			return ExitCodeError, err
+		}
+	}
+
+	summary, err := ApplyPattern(files, fileTags, options)
+	saveRunState(options)
+	summary.WriteTo(os.Stderr)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return summary.ExitCode(), nil
+}
+
+// checkOutputPattern parses and lints an output pattern before any file is
+// touched, logging its warnings and returning its errors.
+func checkOutputPattern(outputPattern string) error {
+	pattern, err := ParsePattern(outputPattern)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, issue := range LintPattern(pattern) {
+		if issue.Warning {
+			log.Println(issue)
+			continue
+		}
+		errs = append(errs, issue.String())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid output pattern %q:\n  %s", outputPattern, strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// recoverInterruptedRenames finishes the renames of an interrupted run before
+// new ones are planned.
+func recoverInterruptedRenames(options RenameOptions) error {
+	if options.DryRun || options.Plan != nil {
+		if _, err := os.Stat(options.Journal); err == nil {
+			log.Printf("%s: a previous run was interrupted; run without --dryrun to recover it", options.Journal)
+		}
+		return nil
+	}
+	recovered, recoverErrs, err := RecoverRenameJournal(options.Journal)
+	if err != nil {
+		return err
+	}
+	if recovered > 0 || len(recoverErrs) > 0 {
+		log.Printf("recovered %d renames from an interrupted run", recovered)
+	}
+	for _, recoverErr := range recoverErrs {
+		log.Println(recoverErr)
+	}
+	return nil
+}
+
+// saveRunState saves the metadata cache, and the index counters of a run that
+// renamed files.
+func saveRunState(options RenameOptions) {
+	if options.Cache != nil {
+		if cacheErr := options.Cache.Save(); cacheErr != nil {
+			log.Println(cacheErr)
+		}
+	}
+	if countersFile := ArgsCountersFile(); len(countersFile) > 0 && !options.DryRun && options.Plan == nil {
+		if countersErr := SaveIndexCounters(countersFile, options.Collector); countersErr != nil {
+			log.Println(countersErr)
+		}
+	}
+}
+
+// runApplyCommand runs the `apply` command.
+func runApplyCommand(args []string) (int, error) {
+	if len(args) != 1 {
+		return ExitCodeError, fmt.Errorf("apply: expected a plan file")
+	}
+	plan, err := ReadRenamePlan(args[0])
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return runRenamePlan(plan)
+}
+
+// runUndoCommand runs the `undo` command.
+func runUndoCommand(args []string) (int, error) {
+	if len(args) > 0 {
+		return ExitCodeError, fmt.Errorf("undo: unexpected argument %q", args[0])
+	}
+	workDir, err := ArgsWorkDirAbsolute()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	plan, err := ReadRenamePlan(filepath.Join(workDir, DefaultUndoLogFile))
+	if os.IsNotExist(err) {
+		return ExitCodeError, fmt.Errorf("undo: there is no run to undo in %s", workDir)
+	}
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return runRenamePlan(plan.Invert())
+}
+
+// runRenamePlan runs the renames of a plan, returning the exit code.
+func runRenamePlan(plan *RenamePlan) (int, error) {
+	workDir, err := ArgsWorkDirAbsolute()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	onError, err := ArgsOnError()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	options := RenameOptions{
+		OnError: onError,
+		DryRun:  ArgsDryRun(),
+		Journal: filepath.Join(workDir, DefaultRenameJournalFile),
+		UndoLog: filepath.Join(workDir, DefaultUndoLogFile),
+	}
+	if err = recoverInterruptedRenames(options); err != nil {
+		return ExitCodeError, err
+	}
+
+	summary := NewRunSummary()
+	err = RunRenames(summary, plan.Renames, options)
+	summary.WriteTo(os.Stderr)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return summary.ExitCode(), nil
+}
+
+// runInspectCommand runs the `inspect` command.
+func runInspectCommand(args []string) (int, error) {
+	if len(args) == 0 {
+		return ExitCodeError, fmt.Errorf("inspect: expected a file")
+	}
+	format := ArgsFormat()
+	if format != InspectFormatTable && format != InspectFormatJSON {
+		return ExitCodeError, fmt.Errorf("inspect: invalid format %q; must be one of table or json", format)
+	}
+	options := RenameOptions{
+		Jobs:             ArgsJobs(),
+		Similar:          ArgsSimilar(),
+		SimilarThreshold: ArgsSimilarThreshold(),
+		SequenceGap:      ArgsSequenceGap(),
+		EventGap:         ArgsEventGap(),
+		EventDistance:    ArgsEventDistance(),
+	}
+	var err error
+	if options.EventNames, err = ArgsEventNames(); err != nil {
+		return ExitCodeError, err
+	}
+	if options.Lookups, err = ArgsLookups(); err != nil {
+		return ExitCodeError, err
+	}
+	if options.Cache, err = ArgsMetadataCache(); err != nil {
+		return ExitCodeError, err
+	}
+
+	// cache entries are keyed by absolute path, as they are by the other commands.
+	paths := make([]string, len(args))
+	for index, arg := range args {
+		paths[index] = absolutePath(arg)
+	}
+	files := InspectFiles(ExtractMetadata(paths, options.Jobs, options.Cache), options)
+	if options.Cache != nil {
+		if cacheErr := options.Cache.Save(); cacheErr != nil {
+			log.Println(cacheErr)
+		}
+	}
+	if err = WriteInspectedFiles(os.Stdout, files, format); err != nil {
+		return ExitCodeError, err
+	}
+	for _, file := range files {
+		if len(file.Error) > 0 {
+			return ExitCodePartial, nil
+		}
+	}
+	return ExitCodeOK, nil
+}
+
+// runVerifyCommand runs the `verify` command, returning the exit code.
+func runVerifyCommand(args []string) (int, error) {
+	if len(args) > 0 {
+		return ExitCodeError, fmt.Errorf("verify: unexpected argument %q", args[0])
+	}
+	if err := checkOutputPattern(ArgsOutputFilePattern()); err != nil {
+		return ExitCodeError, err
+	}
+	workDir, err := ArgsWorkDirAbsolute()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	cache, err := ArgsMetadataCache()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	fileFilter, err := ArgsFileFilter()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	files, err := FilesInDirectoryWithFilter(workDir, fileFilter)
+	if err != nil {
+		return ExitCodeError, err
+	}
+
+	where, err := ArgsWhere()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	metas := FilterWhere(ExtractMetadata(files, ArgsJobs(), cache), where)
+	if cache != nil {
+		if cacheErr := cache.Save(); cacheErr != nil {
+			log.Println(cacheErr)
+		}
+	}
+	results, err := VerifyFiles(metas, ArgsDestinationPattern())
+	if err != nil {
+		return ExitCodeError, err
+	}
+	failed, err := WriteVerifyResults(os.Stdout, results)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	fmt.Fprintf(os.Stderr, "%d verified, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		return ExitCodePartial, nil
+	}
+	return ExitCodeOK, nil
+}
+
+// runWatchCommand runs the `watch` command until it is interrupted.
+func runWatchCommand(args []string) (int, error) {
+	if len(args) > 0 {
+		return ExitCodeError, fmt.Errorf("watch: unexpected argument %q", args[0])
+	}
+	// a template replaces the output pattern, and is checked when it is parsed.
+	if len(ArgsTemplate()) == 0 {
+		if err := checkOutputPattern(ArgsOutputFilePattern()); err != nil {
+			return ExitCodeError, err
+		}
+	}
+	workDir, err := ArgsWorkDirAbsolute()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	options, err := ArgsRenameOptions(workDir)
+	if err != nil {
+		return ExitCodeError, err
+	}
+	if err = recoverInterruptedRenames(options); err != nil {
+		return ExitCodeError, err
+	}
+	fileFilter, err := ArgsFileFilter()
+	if err != nil {
+		return ExitCodeError, err
+	}
+	fileTags := ExtractFileOutputTags(options.OutputFilePattern)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	state := NewWatchState()
+	seeded := !ArgsContinue()
+	log.Printf("watching %s", workDir)
+	for {
+		files, err := FilesInDirectoryWithFilter(workDir, fileFilter, options.DuplicatesDir)
+		if err != nil {
+			return ExitCodeError, err
+		}
+		if !seeded {
+			if _, err = SeedIndexes(options.Collector, options.OutputFilePattern, files, fileFilter, options.Cache); err != nil {
+				return ExitCodeError, err
+			}
+			seeded = true
+		}
+
+		summary, err := state.Rename(files, fileTags, options)
+		if summary != nil {
+			saveRunState(options)
+			// files that arrive already named are only worth reporting if
+			// something happened to them.
+			if summary.Processed > 0 || summary.Duplicates > 0 || len(summary.Skipped) > 0 || len(summary.Fallbacks) > 0 {
+				summary.WriteTo(os.Stderr)
+			}
+		}
+		if err != nil {
+			return ExitCodeError, err
+		}
+
+		select {
+		case <-interrupt:
+			return ExitCodeOK, nil
+		case <-time.After(ArgsInterval()):
+		}
+	}
+}
+
+// runTagsCommand runs the `tags` command.
+func runTagsCommand(args []string) (int, error) {
+	if err := WriteTagNames(os.Stdout); err != nil {
+		return ExitCodeError, err
+	}
+	return ExitCodeOK, nil
+}
+
+// runCacheCommand runs the `cache` subcommands.
+func runCacheCommand(args []string) (int, error) {
+	if len(args) == 0 {
+		return ExitCodeError, fmt.Errorf("cache: expected a subcommand; one of prune or stats")
+	}
+	cache, err := ReadMetadataCache(ArgsCacheFile(), ArgsCacheHash())
+	if err != nil {
+		return ExitCodeError, err
+	}
+
+	switch args[0] {
+	case "prune":
+		{
+			removed := cache.Prune()
+			if err = cache.Save(); err != nil {
+				return ExitCodeError, err
+			}
+			fmt.Printf("pruned %d entries, %d remain\n", removed, len(cache.Entries))
+			return ExitCodeOK, nil
+		}
+	case "stats":
+		{
+			if _, err = cache.Stats().WriteTo(os.Stdout); err != nil {
+				return ExitCodeError, err
+			}
+			return ExitCodeOK, nil
+		}
+	}
+	return ExitCodeError, fmt.Errorf("cache: unknown subcommand %q; must be one of prune or stats", args[0])
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestCommandFlags(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, command := range commands {
+		assert.Equal(command, FindCommand(command.Name))
+		for _, name := range command.Flags {
+			assert.NotNil(allFlags.Lookup(name), command.Name+": "+name)
+		}
+		assert.NotNil(command.FlagSet())
+	}
+	assert.Nil(FindCommand("bogus"))
+	assert.Equal("rename", commands[0].Name)
+}
+
+func TestCommandFlagSet(t *testing.T) {
+	assert := assert.New(t)
+
+	flagSet := FindCommand("apply").FlagSet()
+	assert.NotNil(flagSet.Lookup("on-error"))
+	assert.Nil(flagSet.Lookup("output"))
+
+	// settings for the flags of other commands are ignored.
+	assert.Nil(ApplyConfigSettings(flagSet, map[string]interface{}{"output": "{Make}"}))
+	assert.NotNil(ApplyConfigSettings(flagSet, map[string]interface{}{"nope": "1"}))
+}
+
+func TestRunCommandLine(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(ExitCodeOK, RunCommandLine([]string{"--version"}))
+	assert.Equal(ExitCodeError, RunCommandLine([]string{"apply"}))
+	assert.Equal(ExitCodeError, RunCommandLine([]string{"rename", "unexpected"}))
+}
+
+func TestRunCommandLineAliases(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "image-rename.toml")
+	assert.Nil(ioutil.WriteFile(configPath, []byte("[aliases]\ncamera = \"{Model}\"\n"), 0644))
+	defer allFlags.Set("config", "")
+	defer allFlags.Set("no-cache", "false")
+
+	// inspect has no output pattern for the aliases to expand in.
+	sample := filepath.Join("vendor", "github.com", "rwcarlsen", "goexif", "exif", "sample1.jpg")
+	assert.Equal(ExitCodeOK, RunCommandLine([]string{"inspect", "--config=" + configPath, "--no-cache", sample}))
+}
+
+func TestRunCommandLineInspectCache(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "cache.json")
+	defer allFlags.Set("cache", "")
+
+	sample := filepath.Join("vendor", "github.com", "rwcarlsen", "goexif", "exif", "sample1.jpg")
+	assert.Equal(ExitCodeOK, RunCommandLine([]string{"inspect", "--cache=" + cachePath, sample}))
+
+	cache, err := ReadMetadataCache(cachePath, false)
+	assert.Nil(err)
+	absoluteSample, err := filepath.Abs(sample)
+	assert.Nil(err)
+	assert.Len(cache.Entries, 1)
+	assert.NotNil(cache.Entries[absoluteSample])
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultConfigFile is the name of the config file, without an extension,
+// looked for in the working directory.
+const DefaultConfigFile = "image-rename"
+
+// configExtensions are the config file extensions, in the order they are
+// looked for.
+var configExtensions = []string{".toml", ".yaml", ".yml"}
+
+// Config is a config file. Settings are flag values applied to every run,
+// profiles are named sets of flag values applied on top of them, and aliases
+// are names for pattern fragments that can be used as tags. The `duplicates`
+// and `on-error` settings are a profile's conflict policy, and are checked
+// when the config file is read.
+type Config struct {
+	Path     string
+	Settings map[string]interface{}
+	Aliases  map[string]string
+	Profiles map[string]*ConfigProfile
+}
+
+// ConfigProfile is a named set of flag values and aliases.
+type ConfigProfile struct {
+	Settings map[string]interface{}
+	Aliases  map[string]string
+}
+
+// FindConfigFile returns the path of the config file in the working
+// directory, or else in the `image-rename` directory of the user config
+// directory, or empty if there is neither.
+func FindConfigFile(workDir string) string {
+	var candidates []string
+	for _, extension := range configExtensions {
+		candidates = append(candidates, filepath.Join(workDir, DefaultConfigFile+extension))
+	}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		for _, extension := range configExtensions {
+			candidates = append(candidates, filepath.Join(configDir, "image-rename", "config"+extension))
+		}
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// ReadConfig reads a toml or yaml config file, by its extension.
+func ReadConfig(path string) (*Config, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := decodeConfig(filepath.Ext(path), contents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	config, err := NewConfig(tree)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	config.Path = path
+	return config, nil
+}
+
+// decodeConfig decodes a config file as yaml for a yaml extension and as
+// toml otherwise.
+func decodeConfig(extension string, contents []byte) (map[string]interface{}, error) {
+	switch strings.ToLower(extension) {
+	case ".yaml", ".yml":
+		{
+			var document map[interface{}]interface{}
+			if err := yaml.Unmarshal(contents, &document); err != nil {
+				return nil, err
+			}
+			return yamlConfigValue(document).(map[string]interface{}), nil
+		}
+	}
+	tree := map[string]interface{}{}
+	if _, err := toml.Decode(string(contents), &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// NewConfig returns a config from a parsed config file; the `aliases` table
+// holds aliases, each table in the `profiles` table is a profile, and every
+// other key is a setting.
+func NewConfig(tree map[string]interface{}) (*Config, error) {
+	config := &Config{Profiles: map[string]*ConfigProfile{}}
+	var err error
+	if config.Settings, config.Aliases, err = configSettings(tree); err != nil {
+		return nil, err
+	}
+	if profiles, hasProfiles := tree["profiles"]; hasProfiles {
+		table, isTable := profiles.(map[string]interface{})
+		if !isTable {
+			return nil, fmt.Errorf("profiles must be a table")
+		}
+		for name, value := range table {
+			profileTable, isTable := value.(map[string]interface{})
+			if !isTable {
+				return nil, fmt.Errorf("profile %q must be a table", name)
+			}
+			profile := &ConfigProfile{}
+			if profile.Settings, profile.Aliases, err = configSettings(profileTable); err != nil {
+				return nil, fmt.Errorf("profile %q: %v", name, err)
+			}
+			config.Profiles[name] = profile
+		}
+	}
+	return config, nil
+}
+
+func configSettings(table map[string]interface{}) (map[string]interface{}, map[string]string, error) {
+	settings := map[string]interface{}{}
+	aliases := map[string]string{}
+	for key, value := range table {
+		switch key {
+		case "profiles":
+			continue
+		case "aliases":
+			{
+				aliasTable, isTable := value.(map[string]interface{})
+				if !isTable {
+					return nil, nil, fmt.Errorf("aliases must be a table")
+				}
+				for name, pattern := range aliasTable {
+					patternValue, isString := pattern.(string)
+					if !isString {
+						return nil, nil, fmt.Errorf("alias %q must be a string", name)
+					}
+					aliases[name] = patternValue
+				}
+			}
+		default:
+			{
+				if _, isTable := value.(map[string]interface{}); isTable {
+					return nil, nil, fmt.Errorf("unexpected table %q", key)
+				}
+				// yaml keys are usually written with underscores.
+				key = strings.Replace(key, "_", "-", -1)
+				if err := checkConfigPolicy(key, value); err != nil {
+					return nil, nil, err
+				}
+				settings[key] = value
+			}
+		}
+	}
+	return settings, aliases, nil
+}
+
+// checkConfigPolicy returns an error if a `duplicates` or `on-error` setting
+// isn't a valid policy.
+func checkConfigPolicy(key string, value interface{}) error {
+	var err error
+	switch key {
+	case "duplicates":
+		_, err = ParseDuplicatePolicy(fmt.Sprint(value))
+	case "on-error":
+		_, err = ParseErrorPolicy(fmt.Sprint(value))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	return nil
+}
+
+// ProfileNames returns the sorted names of the profiles.
+func (c *Config) ProfileNames() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the settings and aliases of a profile merged over the
+// top level ones; an empty name returns the top level ones.
+func (c *Config) Profile(name string) (map[string]interface{}, map[string]string, error) {
+	settings := map[string]interface{}{}
+	aliases := map[string]string{}
+	for key, value := range c.Settings {
+		settings[key] = value
+	}
+	for key, value := range c.Aliases {
+		aliases[key] = value
+	}
+	if len(name) == 0 {
+		return settings, aliases, nil
+	}
+	profile, hasProfile := c.Profiles[name]
+	if !hasProfile {
+		return nil, nil, fmt.Errorf("%s: no profile %q; profiles are %s", c.Path, name, strings.Join(c.ProfileNames(), ", "))
+	}
+	for key, value := range profile.Settings {
+		settings[key] = value
+	}
+	for key, value := range profile.Aliases {
+		aliases[key] = value
+	}
+	return settings, aliases, nil
+}
+
+// ApplyConfigSettings sets each flag that has a setting and was not set on
+// the command line; settings for flags the flag set doesn't have are ignored
+// if another command has them. A list sets a repeatable flag once per item, and is
+// joined by commas for any other flag.
+func ApplyConfigSettings(flagSet *flag.FlagSet, settings map[string]interface{}) error {
+	explicit := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var keys []string
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "config" || key == "profile" {
+			return fmt.Errorf("%s cannot be set in a config file", key)
+		}
+		f := flagSet.Lookup(key)
+		if f == nil {
+			// a setting can be for the flags of another command.
+			if allFlags.Lookup(key) != nil {
+				continue
+			}
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if explicit[key] {
+			continue
+		}
+
+		var values []string
+		if list, isList := settings[key].([]interface{}); isList {
+			for _, item := range list {
+				values = append(values, fmt.Sprint(item))
+			}
+			if _, isRepeatable := f.Value.(*stringsFlag); !isRepeatable {
+				values = []string{strings.Join(values, ",")}
+			}
+		} else {
+			values = []string{fmt.Sprint(settings[key])}
+		}
+		for _, value := range values {
+			if err := flagSet.Set(key, value); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ExpandAliases replaces every alias tag in a pattern, including in quoted
+// index scopes, with its pattern fragment; an alias can use other aliases.
+// Escaped braces are left as is.
+func ExpandAliases(source string, aliases map[string]string) (string, error) {
+	var pairs []string
+	for name, value := range aliases {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	inTags := strings.NewReplacer(pairs...)
+
+	for depth := 0; depth <= len(aliases); depth++ {
+		pattern, err := ParsePattern(source)
+		if err != nil {
+			return "", err
+		}
+		var expanded strings.Builder
+		for _, node := range pattern.Nodes {
+			if node.Tag == nil {
+				expanded.WriteString(EscapePatternLiteral(node.Literal))
+				continue
+			}
+			if value, isAlias := aliases[node.Tag.Source]; isAlias {
+				expanded.WriteString(value)
+				continue
+			}
+			expanded.WriteString("{" + inTags.Replace(node.Tag.Source) + "}")
+		}
+		if expanded.String() == source {
+			return source, nil
+		}
+		source = expanded.String()
+	}
+	return "", fmt.Errorf("aliases: %q refers back to itself", source)
+}
+
+// yamlConfigValue converts a decoded yaml value to the types toml decodes
+// to, so both formats give the same settings: mappings get string keys,
+// integers are int64 and an empty value is an empty string.
+func yamlConfigValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		{
+			table := map[string]interface{}{}
+			for key, item := range typed {
+				table[fmt.Sprint(key)] = yamlConfigValue(item)
+			}
+			return table
+		}
+	case []interface{}:
+		{
+			list := make([]interface{}, len(typed))
+			for index, item := range typed {
+				list[index] = yamlConfigValue(item)
+			}
+			return list
+		}
+	case int:
+		return int64(typed)
+	case nil:
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+const configTestTOML = `# shared settings
+type = "photo"
+on-error = "skip"
+
+[aliases]
+date = "{DateTimeOriginal.Year}{DateTimeOriginal.Month}{DateTimeOriginal.Day}"
+
+[profiles.wedding]
+output = "{date}_{camera}_{Index scope=camera}.{File.Extension}" # the usual
+dest = '/mnt/nas/weddings'
+include = [
+	"**/*.JPG",
+	"**/*.CR2", # raw too
+]
+similar-threshold = 12
+dryrun = true
+
+[profiles.wedding.aliases]
+camera = "{Model}"
+
+[profiles."card dump"]
+duplicates = "skip"
+on-error = "fallback"
+event-distance = 1.5
+`
+
+const configTestYAML = `# shared settings
+type: photo
+on_error: skip
+
+aliases:
+  date: "{DateTimeOriginal.Year}{DateTimeOriginal.Month}{DateTimeOriginal.Day}"
+
+profiles:
+  wedding:
+    output: "{date}_{camera}_{Index scope=camera}.{File.Extension}" # the usual
+    dest: '/mnt/nas/weddings'
+    include:
+    - "**/*.JPG"
+    - "**/*.CR2"
+    similar_threshold: 12
+    dryrun: true
+    aliases:
+      camera: "{Model}"
+  card dump:
+    duplicates: skip
+    on_error: fallback
+    event-distance: 1.5
+`
+
+func configTestFlagSet() (*flag.FlagSet, *stringsFlag) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	var include stringsFlag
+	flagSet.Var(&include, "include", "")
+	flagSet.String("type", DefaultMediaTypes, "")
+	flagSet.String("on-error", "abort", "")
+	flagSet.String("output", DefaultFileOutputPattern, "")
+	flagSet.String("dest", "", "")
+	flagSet.String("duplicates", "none", "")
+	flagSet.Int("similar-threshold", DefaultSimilarThreshold, "")
+	flagSet.Float64("event-distance", 0, "")
+	flagSet.Bool("dryrun", false, "")
+	return flagSet, &include
+}
+
+func assertConfigTestProfiles(assert *assert.Assertions, config *Config) {
+	assert.Equal([]string{"card dump", "wedding"}, config.ProfileNames())
+
+	settings, aliases, err := config.Profile("wedding")
+	assert.Nil(err)
+	assert.Equal("photo", settings["type"])
+	assert.Equal("skip", settings["on-error"])
+	assert.Equal("{date}_{camera}_{Index scope=camera}.{File.Extension}", settings["output"])
+	assert.Equal("/mnt/nas/weddings", settings["dest"])
+	assert.Equal([]interface{}{"**/*.JPG", "**/*.CR2"}, settings["include"])
+	assert.Equal(int64(12), settings["similar-threshold"])
+	assert.Equal(true, settings["dryrun"])
+	assert.Equal("{Model}", aliases["camera"])
+	assert.Equal("{DateTimeOriginal.Year}{DateTimeOriginal.Month}{DateTimeOriginal.Day}", aliases["date"])
+
+	settings, aliases, err = config.Profile("card dump")
+	assert.Nil(err)
+	assert.Equal("skip", settings["duplicates"])
+	assert.Equal("fallback", settings["on-error"])
+	assert.Equal(1.5, settings["event-distance"])
+	assert.Nil(settings["output"])
+	assert.Len(aliases, 1)
+
+	_, _, err = config.Profile("birthday")
+	assert.NotNil(err)
+}
+
+func TestDecodeConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	for extension, source := range map[string]string{".toml": configTestTOML, ".yaml": configTestYAML, ".YML": configTestYAML} {
+		tree, err := decodeConfig(extension, []byte(source))
+		assert.Nil(err, extension)
+		config, err := NewConfig(tree)
+		assert.Nil(err, extension)
+		if config != nil {
+			assertConfigTestProfiles(assert, config)
+		}
+	}
+
+	tree, err := decodeConfig(".yaml", []byte("---\n1: one\nempty:\nlist: [a, 2]\n"))
+	assert.Nil(err)
+	assert.Equal("one", tree["1"])
+	assert.Equal("", tree["empty"])
+	assert.Equal([]interface{}{"a", int64(2)}, tree["list"])
+
+	_, err = decodeConfig(".toml", []byte("output = {Make}"))
+	assert.NotNil(err)
+	_, err = decodeConfig(".yaml", []byte("a: 1\n  b: 2"))
+	assert.NotNil(err)
+	_, err = decodeConfig(".yaml", []byte("just a value"))
+	assert.NotNil(err)
+	_, err = NewConfig(map[string]interface{}{"dest": map[string]interface{}{"a": "b"}})
+	assert.NotNil(err)
+	_, err = NewConfig(map[string]interface{}{"profiles": map[string]interface{}{"wedding": map[string]interface{}{"duplicates": "symlink"}}})
+	assert.NotNil(err)
+	_, err = NewConfig(map[string]interface{}{"on_error": "ignore"})
+	assert.NotNil(err)
+}
+
+func TestApplyConfigSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	flagSet, include := configTestFlagSet()
+	assert.Nil(flagSet.Parse([]string{"--dest=/tmp/out", "--type=raw"}))
+
+	tree, err := decodeConfig(".toml", []byte(configTestTOML))
+	assert.Nil(err)
+	config, err := NewConfig(tree)
+	assert.Nil(err)
+	settings, _, err := config.Profile("wedding")
+	assert.Nil(err)
+	assert.Nil(ApplyConfigSettings(flagSet, settings))
+
+	// flags on the command line win over the config.
+	assert.Equal("/tmp/out", flagSet.Lookup("dest").Value.String())
+	assert.Equal("raw", flagSet.Lookup("type").Value.String())
+	assert.Equal("skip", flagSet.Lookup("on-error").Value.String())
+	assert.Equal("12", flagSet.Lookup("similar-threshold").Value.String())
+	assert.Equal("true", flagSet.Lookup("dryrun").Value.String())
+	assert.Equal([]string{"**/*.JPG", "**/*.CR2"}, []string(*include))
+
+	flagSet, include = configTestFlagSet()
+	assert.Nil(flagSet.Parse([]string{"--include=*.jpg"}))
+	assert.Nil(ApplyConfigSettings(flagSet, settings))
+	assert.Equal([]string{"*.jpg"}, []string(*include))
+
+	flagSet, _ = configTestFlagSet()
+	assert.Nil(ApplyConfigSettings(flagSet, map[string]interface{}{"type": []interface{}{"jpeg", "raw"}}))
+	assert.Equal("jpeg,raw", flagSet.Lookup("type").Value.String())
+
+	assert.NotNil(ApplyConfigSettings(flagSet, map[string]interface{}{"nope": "1"}))
+	assert.NotNil(ApplyConfigSettings(flagSet, map[string]interface{}{"similar-threshold": "many"}))
+	flagSet.String("profile", "", "")
+	assert.NotNil(ApplyConfigSettings(flagSet, map[string]interface{}{"profile": "wedding"}))
+}
+
+func TestExpandAliases(t *testing.T) {
+	assert := assert.New(t)
+
+	aliases := map[string]string{
+		"date":   "{DateTimeOriginal.Year}{DateTimeOriginal.Month}{DateTimeOriginal.Day}",
+		"camera": "{Make}_{Model}",
+		"prefix": "{date}_{camera}",
+	}
+	pattern, err := ExpandAliases("{prefix}_{Index scope=\"{camera}\"}.{File.Extension}", aliases)
+	assert.Nil(err)
+	assert.Equal("{DateTimeOriginal.Year}{DateTimeOriginal.Month}{DateTimeOriginal.Day}_{Make}_{Model}_{Index scope=\"{Make}_{Model}\"}.{File.Extension}", pattern)
+
+	_, err = ExpandAliases("{a}", map[string]string{"a": "{b}", "b": "x{a}"})
+	assert.NotNil(err)
+}
+
+func TestFindConfigFile(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(tempDir)
+
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(tempDir, "config"))
+	assert.Empty(FindConfigFile(tempDir))
+
+	configPath := filepath.Join(tempDir, "image-rename.yaml")
+	assert.Nil(ioutil.WriteFile(configPath, []byte(configTestYAML), 0644))
+	assert.Equal(configPath, FindConfigFile(tempDir))
+
+	config, err := ReadConfig(configPath)
+	assert.Nil(err)
+	assert.Equal(configPath, config.Path)
+	assertConfigTestProfiles(assert, config)
+
+	tomlPath := filepath.Join(tempDir, "image-rename.toml")
+	assert.Nil(ioutil.WriteFile(tomlPath, []byte(configTestTOML), 0644))
+	assert.Equal(tomlPath, FindConfigFile(tempDir))
+}
@@ -8,15 +8,18 @@ func NewDateIndexCollector() *DateIndexCollector {
 		ByYear:  map[int]int{},
 		ByMonth: map[int]map[time.Month]int{},
 		ByDay:   map[int]map[time.Month]map[int]int{},
+		ByScope: map[string]map[string]int{},
 	}
 }
 
-// DateIndexCollector returns indexes by various components of a date.
+// DateIndexCollector returns indexes by various components of a date, and by
+// arbitrary scopes.
 type DateIndexCollector struct {
-	Count   int
-	ByYear  map[int]int
-	ByMonth map[int]map[time.Month]int
-	ByDay   map[int]map[time.Month]map[int]int
+	Count   int                                `json:"count"`
+	ByYear  map[int]int                        `json:"by_year"`
+	ByMonth map[int]map[time.Month]int         `json:"by_month"`
+	ByDay   map[int]map[time.Month]map[int]int `json:"by_day"`
+	ByScope map[string]map[string]int          `json:"by_scope"`
 }
 
 // Len returns the total number of elements counted.
@@ -28,19 +31,25 @@ func (dtic *DateIndexCollector) Len() int {
 func (dtic *DateIndexCollector) Add(timestamp time.Time) {
 	dtic.Count++
 	dtic.ByYear[timestamp.Year()]++
+	dtic.months(timestamp)[timestamp.Month()]++
+	dtic.days(timestamp)[timestamp.Day()]++
+}
 
+func (dtic *DateIndexCollector) months(timestamp time.Time) map[time.Month]int {
 	if _, hasYear := dtic.ByMonth[timestamp.Year()]; !hasYear {
 		dtic.ByMonth[timestamp.Year()] = map[time.Month]int{}
 	}
-	dtic.ByMonth[timestamp.Year()][timestamp.Month()]++
+	return dtic.ByMonth[timestamp.Year()]
+}
 
+func (dtic *DateIndexCollector) days(timestamp time.Time) map[int]int {
 	if _, hasYear := dtic.ByDay[timestamp.Year()]; !hasYear {
 		dtic.ByDay[timestamp.Year()] = map[time.Month]map[int]int{}
 	}
 	if _, hasMonth := dtic.ByDay[timestamp.Year()][timestamp.Month()]; !hasMonth {
 		dtic.ByDay[timestamp.Year()][timestamp.Month()] = map[int]int{}
 	}
-	dtic.ByDay[timestamp.Year()][timestamp.Month()][timestamp.Day()]++
+	return dtic.ByDay[timestamp.Year()][timestamp.Month()]
 }
 
 // GetIndexByYear returns the index by the year.
@@ -69,3 +78,55 @@ func (dtic DateIndexCollector) GetIndexByDay(timestamp time.Time) int {
 	}
 	return 0
 }
+
+// IncrementScope increments the bucket for a key within a scope and returns
+// the new index.
+func (dtic *DateIndexCollector) IncrementScope(scope, key string) int {
+	if _, hasScope := dtic.ByScope[scope]; !hasScope {
+		dtic.ByScope[scope] = map[string]int{}
+	}
+	dtic.ByScope[scope][key]++
+	return dtic.ByScope[scope][key]
+}
+
+// SeedCount raises the total count to at least an existing index.
+func (dtic *DateIndexCollector) SeedCount(index int) {
+	if index > dtic.Count {
+		dtic.Count = index
+	}
+}
+
+// SeedYear raises the index for the year of a timestamp to at least an
+// existing index.
+func (dtic *DateIndexCollector) SeedYear(timestamp time.Time, index int) {
+	if index > dtic.ByYear[timestamp.Year()] {
+		dtic.ByYear[timestamp.Year()] = index
+	}
+}
+
+// SeedMonth raises the index for the month of a timestamp to at least an
+// existing index.
+func (dtic *DateIndexCollector) SeedMonth(timestamp time.Time, index int) {
+	if months := dtic.months(timestamp); index > months[timestamp.Month()] {
+		months[timestamp.Month()] = index
+	}
+}
+
+// SeedDay raises the index for the day of a timestamp to at least an existing
+// index.
+func (dtic *DateIndexCollector) SeedDay(timestamp time.Time, index int) {
+	if days := dtic.days(timestamp); index > days[timestamp.Day()] {
+		days[timestamp.Day()] = index
+	}
+}
+
+// SeedScope raises the index for a key within a scope to at least an existing
+// index.
+func (dtic *DateIndexCollector) SeedScope(scope, key string, index int) {
+	if _, hasScope := dtic.ByScope[scope]; !hasScope {
+		dtic.ByScope[scope] = map[string]int{}
+	}
+	if index > dtic.ByScope[scope][key] {
+		dtic.ByScope[scope][key] = index
+	}
+}
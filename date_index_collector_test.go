@@ -26,3 +26,13 @@ func TestDateIndexCollector(t *testing.T) {
 	assert.Equal(2, collector.GetIndexByDay(time.Date(2016, 01, 02, 0, 0, 0, 0, time.UTC)))
 	assert.Equal(3, collector.GetIndexByDay(time.Date(2016, 01, 03, 0, 0, 0, 0, time.UTC)))
 }
+
+func TestDateIndexCollectorScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	collector := NewDateIndexCollector()
+	assert.Equal(1, collector.IncrementScope("camera", "5D"))
+	assert.Equal(1, collector.IncrementScope("camera", "7D"))
+	assert.Equal(2, collector.IncrementScope("camera", "5D"))
+	assert.Equal(1, collector.IncrementScope("directory", "5D"))
+}
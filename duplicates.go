@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultDuplicatesDir is the directory, relative to the working directory,
+	// that duplicates are moved to.
+	DefaultDuplicatesDir = "duplicates"
+
+	// shortHashLength is the length of `File.Hash.Short`.
+	shortHashLength = 8
+)
+
+// DuplicatePolicy determines what happens to files whose contents are
+// identical to an earlier file.
+type DuplicatePolicy string
+
+// duplicate policies
+const (
+	// DuplicatePolicyNone disables duplicate detection.
+	DuplicatePolicyNone DuplicatePolicy = "none"
+
+	// DuplicatePolicySkip leaves duplicates untouched.
+	DuplicatePolicySkip DuplicatePolicy = "skip"
+
+	// DuplicatePolicyMove moves duplicates to the duplicates directory.
+	DuplicatePolicyMove DuplicatePolicy = "move"
+
+	// DuplicatePolicyHardlink replaces duplicates with a hard link to the original.
+	DuplicatePolicyHardlink DuplicatePolicy = "hardlink"
+
+	// DuplicatePolicyDelete deletes duplicates after confirmation.
+	DuplicatePolicyDelete DuplicatePolicy = "delete"
+)
+
+// ParseDuplicatePolicy parses a duplicate policy.
+func ParseDuplicatePolicy(value string) (DuplicatePolicy, error) {
+	switch policy := DuplicatePolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case DuplicatePolicyNone, DuplicatePolicySkip, DuplicatePolicyMove, DuplicatePolicyHardlink, DuplicatePolicyDelete:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid duplicate policy %q; must be one of none, skip, move, hardlink or delete", value)
+}
+
+// ShortHash returns the abbreviated form of a hash.
+func ShortHash(hash string) string {
+	if len(hash) > shortHashLength {
+		return hash[:shortHashLength]
+	}
+	return hash
+}
+
+// EnsureHash hashes the file contents if they have not been hashed already.
+func (fm *FileMetadata) EnsureHash() (string, error) {
+	if len(fm.Hash) > 0 {
+		return fm.Hash, nil
+	}
+	hash, err := HashFile(fm.Path)
+	if err != nil {
+		return "", NewFileError(ErrorKindIO, fm.Path, "", err)
+	}
+	fm.Hash = hash
+	return hash, nil
+}
+
+// DuplicateGroup is a set of files with identical contents, in file order.
+type DuplicateGroup struct {
+	Hash  string
+	Files []*FileMetadata
+}
+
+// Original returns the file that is kept.
+func (dg DuplicateGroup) Original() *FileMetadata {
+	return dg.Files[0]
+}
+
+// Duplicates returns the files that are copies of the original.
+func (dg DuplicateGroup) Duplicates() []*FileMetadata {
+	return dg.Files[1:]
+}
+
+// FindDuplicates groups files with identical contents. Files are bucketed by
+// size first so only files that share a size are hashed.
+// Files that cannot be hashed have their error set and are not grouped.
+func FindDuplicates(metas []*FileMetadata, jobs int) []DuplicateGroup {
+	bySize := map[int64][]*FileMetadata{}
+	for _, meta := range metas {
+		if meta.Info == nil {
+			continue
+		}
+		bySize[meta.Info.Size()] = append(bySize[meta.Info.Size()], meta)
+	}
+
+	var candidates []*FileMetadata
+	for _, meta := range metas {
+		if meta.Info != nil && len(bySize[meta.Info.Size()]) > 1 {
+			candidates = append(candidates, meta)
+		}
+	}
+
+	ForEachParallel(len(candidates), jobs, func(index int) {
+		if _, err := candidates[index].EnsureHash(); err != nil {
+			candidates[index].Err = err
+		}
+	})
+
+	byHash := map[string]*DuplicateGroup{}
+	var groups []*DuplicateGroup
+	for _, meta := range candidates {
+		if len(meta.Hash) == 0 {
+			continue
+		}
+		group, hasGroup := byHash[meta.Hash]
+		if !hasGroup {
+			group = &DuplicateGroup{Hash: meta.Hash}
+			byHash[meta.Hash] = group
+			groups = append(groups, group)
+		}
+		group.Files = append(group.Files, meta)
+	}
+
+	var duplicates []DuplicateGroup
+	for _, group := range groups {
+		if len(group.Files) > 1 {
+			duplicates = append(duplicates, *group)
+		}
+	}
+	return duplicates
+}
+
+// ResolveDuplicates applies the duplicate policy to each group, returning the
+// set of files that should not be renamed.
+func ResolveDuplicates(groups []DuplicateGroup, options RenameOptions, summary *RunSummary) (map[*FileMetadata]bool, error) {
+	duplicates := map[*FileMetadata]bool{}
+	if len(groups) == 0 {
+		return duplicates, nil
+	}
+
+	policy := options.Duplicates
+	if policy == DuplicatePolicyDelete && !options.DryRun && !options.AssumeYes {
+		var count int
+		for _, group := range groups {
+			count += len(group.Duplicates())
+		}
+		if !Confirm(fmt.Sprintf("delete %d duplicate files?", count)) {
+			policy = DuplicatePolicySkip
+		}
+	}
+
+	for _, group := range groups {
+		if options.DryRun {
+			fmt.Printf("duplicates %s:\n  %s\n", ShortHash(group.Hash), group.Original().Path)
+		}
+		for _, duplicate := range group.Duplicates() {
+			duplicates[duplicate] = true
+			summary.Duplicate()
+			if options.DryRun {
+				fmt.Printf("  %s (%s)\n", duplicate.Path, policy)
+				continue
+			}
+			if err := resolveDuplicate(policy, group.Original(), duplicate, options.DuplicatesDir); err != nil {
+				fileErr := AsFileError(duplicate.Path, err)
+				if options.OnError == ErrorPolicyAbort {
+					return duplicates, fileErr
+				}
+				summary.Skip(fileErr)
+			}
+		}
+	}
+	return duplicates, nil
+}
+
+func resolveDuplicate(policy DuplicatePolicy, original, duplicate *FileMetadata, duplicatesDir string) error {
+	switch policy {
+	case DuplicatePolicyMove:
+		{
+			if err := os.MkdirAll(duplicatesDir, 0755); err != nil {
+				return err
+			}
+			target := filepath.Join(duplicatesDir, filepath.Base(duplicate.Path))
+			if _, err := os.Stat(target); err == nil {
+				return fmt.Errorf("duplicates: %s already exists", target)
+			}
+			return os.Rename(duplicate.Path, target)
+		}
+	case DuplicatePolicyHardlink:
+		{
+			// link to a unique temporary name first so the duplicate is replaced atomically.
+			temp, err := ioutil.TempFile(filepath.Dir(duplicate.Path), "."+filepath.Base(duplicate.Path)+".*.link")
+			if err != nil {
+				return err
+			}
+			tempPath := temp.Name()
+			temp.Close()
+			if err = os.Remove(tempPath); err != nil {
+				return err
+			}
+			if err = os.Link(original.Path, tempPath); err != nil {
+				return err
+			}
+			if err = os.Rename(tempPath, duplicate.Path); err != nil {
+				os.Remove(tempPath)
+				return err
+			}
+			return nil
+		}
+	case DuplicatePolicyDelete:
+		{
+			return os.Remove(duplicate.Path)
+		}
+	}
+	return nil
+}
+
+// Confirm prompts on stdout and reads a yes or no answer from stdin.
+func Confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(tempDir)
+
+	contents := map[string]string{
+		"a.jpg": "aaaa",
+		"b.jpg": "bbbb",
+		"c.jpg": "aaaa",
+		"d.jpg": "ccccc",
+		"e.jpg": "aaaa",
+	}
+	var files []string
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg"} {
+		file := filepath.Join(tempDir, name)
+		assert.Nil(ioutil.WriteFile(file, []byte(contents[name]), 0644))
+		files = append(files, file)
+	}
+
+	metas := ExtractMetadata(files, 2, nil)
+	groups := FindDuplicates(metas, 2)
+	assert.Len(groups, 1)
+	assert.Equal(files[0], groups[0].Original().Path)
+	assert.Len(groups[0].Duplicates(), 2)
+	assert.Equal(files[2], groups[0].Duplicates()[0].Path)
+	assert.Equal(files[4], groups[0].Duplicates()[1].Path)
+
+	// files with a unique size are never hashed.
+	assert.Empty(metas[3].Hash)
+	assert.NotEmpty(metas[1].Hash)
+}
+
+func TestResolveDuplicatesMove(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(tempDir)
+
+	original := filepath.Join(tempDir, "a.jpg")
+	duplicate := filepath.Join(tempDir, "b.jpg")
+	assert.Nil(ioutil.WriteFile(original, []byte("contents"), 0644))
+	assert.Nil(ioutil.WriteFile(duplicate, []byte("contents"), 0644))
+
+	metas := ExtractMetadata([]string{original, duplicate}, 1, nil)
+	summary := NewRunSummary()
+	options := RenameOptions{
+		Duplicates:    DuplicatePolicyMove,
+		DuplicatesDir: filepath.Join(tempDir, DefaultDuplicatesDir),
+		OnError:       ErrorPolicyAbort,
+	}
+	skipped, err := ResolveDuplicates(FindDuplicates(metas, 1), options, summary)
+	assert.Nil(err)
+	assert.True(skipped[metas[1]])
+	assert.False(skipped[metas[0]])
+	assert.Equal(1, summary.Duplicates)
+
+	_, err = os.Stat(filepath.Join(tempDir, DefaultDuplicatesDir, "b.jpg"))
+	assert.Nil(err)
+	_, err = os.Stat(duplicate)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestResolveDuplicatesHardlink(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(tempDir)
+
+	original := filepath.Join(tempDir, "a.jpg")
+	duplicate := filepath.Join(tempDir, "b.jpg")
+	assert.Nil(ioutil.WriteFile(original, []byte("contents"), 0644))
+	assert.Nil(ioutil.WriteFile(duplicate, []byte("contents"), 0644))
+	// a file left at the old fixed temporary name must not get in the way.
+	assert.Nil(ioutil.WriteFile(duplicate+".link", []byte("other"), 0644))
+
+	metas := ExtractMetadata([]string{original, duplicate}, 1, nil)
+	summary := NewRunSummary()
+	options := RenameOptions{
+		Duplicates: DuplicatePolicyHardlink,
+		OnError:    ErrorPolicyAbort,
+	}
+	_, err = ResolveDuplicates(FindDuplicates(metas, 1), options, summary)
+	assert.Nil(err)
+
+	originalInfo, err := os.Stat(original)
+	assert.Nil(err)
+	duplicateInfo, err := os.Stat(duplicate)
+	assert.Nil(err)
+	assert.True(os.SameFile(originalInfo, duplicateInfo))
+
+	entries, err := ioutil.ReadDir(tempDir)
+	assert.Nil(err)
+	assert.Len(entries, 3)
+}
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := ParseDuplicatePolicy("hardlink")
+	assert.Nil(err)
+	assert.Equal(DuplicatePolicyHardlink, policy)
+
+	_, err = ParseDuplicatePolicy("symlink")
+	assert.NotNil(err)
+	assert.Equal("01234567", ShortHash("0123456789abcdef"))
+}
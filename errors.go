@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorKind is the classification of a file processing error.
+type ErrorKind string
+
+// error kinds
+const (
+	// ErrorKindNoExif is returned when a file has no decodable exif data.
+	ErrorKindNoExif ErrorKind = "no exif data"
+
+	// ErrorKindMissingTag is returned when a tag is not present in a file.
+	ErrorKindMissingTag ErrorKind = "missing tag"
+
+	// ErrorKindInvalidDate is returned when a timestamp tag cannot be parsed.
+	ErrorKindInvalidDate ErrorKind = "unparsable date"
+
+	// ErrorKindIO is returned when a file cannot be read, stat'ed or moved.
+	ErrorKindIO ErrorKind = "i/o error"
+
+	// ErrorKindScript is returned when the rename script fails for a file.
+	ErrorKindScript ErrorKind = "script error"
+)
+
+// FileError is an error encountered while processing a single file.
+type FileError struct {
+	Kind ErrorKind
+	Path string
+	Tag  string
+	Err  error
+}
+
+// Error implements error.
+func (fe *FileError) Error() string {
+	var prefix string
+	if len(fe.Path) > 0 {
+		prefix = fe.Path + ": "
+	}
+	if len(fe.Tag) > 0 {
+		return fmt.Sprintf("%s%s (%s): %v", prefix, fe.Kind, fe.Tag, fe.Err)
+	}
+	return fmt.Sprintf("%s%s: %v", prefix, fe.Kind, fe.Err)
+}
+
+// NewFileError returns a new file error.
+func NewFileError(kind ErrorKind, path, tag string, err error) *FileError {
+	return &FileError{Kind: kind, Path: path, Tag: tag, Err: err}
+}
+
+// ErrorKindOf returns the kind of a file error, or an empty kind if the error
+// is not a file error.
+func ErrorKindOf(err error) ErrorKind {
+	if typed, isTyped := err.(*FileError); isTyped {
+		return typed.Kind
+	}
+	return ""
+}
+
+// IsNoExifError returns if the error is a no exif data error.
+func IsNoExifError(err error) bool {
+	return ErrorKindOf(err) == ErrorKindNoExif
+}
+
+// IsMissingTagError returns if the error is a missing tag error.
+func IsMissingTagError(err error) bool {
+	return ErrorKindOf(err) == ErrorKindMissingTag
+}
+
+// IsInvalidDateError returns if the error is an unparsable date error.
+func IsInvalidDateError(err error) bool {
+	return ErrorKindOf(err) == ErrorKindInvalidDate
+}
+
+// IsIOError returns if the error is an i/o error.
+func IsIOError(err error) bool {
+	return ErrorKindOf(err) == ErrorKindIO
+}
+
+// AsFileError returns an error as a file error for a given path; untyped
+// errors are treated as i/o errors.
+func AsFileError(path string, err error) *FileError {
+	if typed, isTyped := err.(*FileError); isTyped {
+		if len(typed.Path) == 0 {
+			typed.Path = path
+		}
+		return typed
+	}
+	return NewFileError(ErrorKindIO, path, "", err)
+}
+
+// --------------------------------------------------------------------------------
+// Error Policy
+// --------------------------------------------------------------------------------
+
+// ErrorPolicy determines what happens when a file cannot be processed.
+type ErrorPolicy string
+
+// error policies
+const (
+	// ErrorPolicyAbort stops the run on the first error.
+	ErrorPolicyAbort ErrorPolicy = "abort"
+
+	// ErrorPolicySkip leaves the file untouched and continues.
+	ErrorPolicySkip ErrorPolicy = "skip"
+
+	// ErrorPolicyFallback substitutes the file modification time for a missing
+	// capture time and empty values for missing tags; i/o errors still skip.
+	ErrorPolicyFallback ErrorPolicy = "fallback"
+)
+
+// ParseErrorPolicy parses an error policy.
+func ParseErrorPolicy(value string) (ErrorPolicy, error) {
+	switch policy := ErrorPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case ErrorPolicyAbort, ErrorPolicySkip, ErrorPolicyFallback:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid error policy %q; must be one of abort, skip or fallback", value)
+}
+
+// CanFallback returns if the policy allows substituting a value for an error.
+func (ep ErrorPolicy) CanFallback(err error) bool {
+	if ep != ErrorPolicyFallback {
+		return false
+	}
+	switch ErrorKindOf(err) {
+	case ErrorKindNoExif, ErrorKindMissingTag, ErrorKindInvalidDate:
+		return true
+	}
+	return false
+}
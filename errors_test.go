@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestParseErrorPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := ParseErrorPolicy("Skip")
+	assert.Nil(err)
+	assert.Equal(ErrorPolicySkip, policy)
+
+	_, err = ParseErrorPolicy("ignore")
+	assert.NotNil(err)
+}
+
+func TestErrorPolicyCanFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	missing := NewFileError(ErrorKindMissingTag, "a.jpg", "Make", fmt.Errorf("test"))
+	io := NewFileError(ErrorKindIO, "a.jpg", "", fmt.Errorf("test"))
+
+	assert.True(ErrorPolicyFallback.CanFallback(missing))
+	assert.False(ErrorPolicyFallback.CanFallback(io))
+	assert.False(ErrorPolicySkip.CanFallback(missing))
+	assert.False(ErrorPolicyAbort.CanFallback(missing))
+}
+
+func TestAsFileError(t *testing.T) {
+	assert := assert.New(t)
+
+	typed := AsFileError("a.jpg", NewFileError(ErrorKindInvalidDate, "", "DateTime", fmt.Errorf("test")))
+	assert.Equal("a.jpg", typed.Path)
+	assert.True(IsInvalidDateError(typed))
+	assert.Equal("a.jpg: unparsable date (DateTime): test", typed.Error())
+
+	untyped := AsFileError("b.jpg", fmt.Errorf("test"))
+	assert.True(IsIOError(untyped))
+	assert.Equal("b.jpg", untyped.Path)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultEventGap is the default time between shots that starts a new event.
+	DefaultEventGap = 2 * time.Hour
+
+	// earthRadiusKilometers is the mean radius of the earth.
+	earthRadiusKilometers = 6371.0
+)
+
+// eventTimeFormats are the formats accepted for the start and end of an event
+// in an event names file.
+var eventTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Event is a set of shots, from any camera, taken without a long gap between
+// them; in capture order.
+type Event struct {
+	Index int
+	Name  string
+	Start time.Time
+	End   time.Time
+	Files []*FileMetadata
+}
+
+// EventName is a name for the events that start within a time range.
+type EventName struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// Contains returns if a timestamp is within the range, inclusive.
+func (en EventName) Contains(timestamp time.Time) bool {
+	return !timestamp.Before(en.Start) && !timestamp.After(en.End)
+}
+
+// ClusterEvents groups files in capture order into events. A new event starts
+// when the time since the previous shot is at least the gap or, if
+// maxDistance is positive, when both shots have gps coordinates more than
+// maxDistance kilometers apart. Events are named by the first event name whose
+// range contains the event's start.
+func ClusterEvents(metas []*FileMetadata, gap time.Duration, maxDistance float64, names []EventName) []*Event {
+	ordered := make([]*FileMetadata, len(metas))
+	copy(ordered, metas)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].CaptureTime.Before(ordered[j].CaptureTime)
+	})
+
+	var events []*Event
+	var current *Event
+	var last *FileMetadata
+	for _, meta := range ordered {
+		if current == nil || meta.CaptureTime.Sub(last.CaptureTime) >= gap || isDistantShot(last, meta, maxDistance) {
+			current = &Event{Index: len(events) + 1, Start: meta.CaptureTime}
+			events = append(events, current)
+		}
+		current.Files = append(current.Files, meta)
+		current.End = meta.CaptureTime
+		meta.Event = current
+		meta.EventIndex = len(current.Files)
+		last = meta
+	}
+
+	for _, event := range events {
+		for _, name := range names {
+			if name.Contains(event.Start) {
+				event.Name = name.Name
+				break
+			}
+		}
+	}
+	return events
+}
+
+func isDistantShot(previous, next *FileMetadata, maxDistance float64) bool {
+	if maxDistance <= 0 {
+		return false
+	}
+	previousLat, previousLong, err := previous.Exif.LatLong()
+	if err != nil {
+		return false
+	}
+	nextLat, nextLong, err := next.Exif.LatLong()
+	if err != nil {
+		return false
+	}
+	return HaversineDistance(previousLat, previousLong, nextLat, nextLong) > maxDistance
+}
+
+// HaversineDistance returns the great circle distance in kilometers between
+// two coordinates in degrees.
+func HaversineDistance(lat1, long1, lat2, long2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	deltaLat := toRadians(lat2 - lat1)
+	deltaLong := toRadians(long2 - long1)
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(deltaLong/2)*math.Sin(deltaLong/2)
+	return 2 * earthRadiusKilometers * math.Asin(math.Sqrt(a))
+}
+
+// ReadEventNames reads an event names file, a csv of `start,end,name` rows.
+// Start and end are dates or date times; an end date with no time includes
+// the whole day. Lines starting with `#` are ignored.
+func ReadEventNames(filePath string) ([]EventName, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseEventNames(file)
+}
+
+// ParseEventNames parses event names from a csv reader.
+func ParseEventNames(r io.Reader) ([]EventName, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var names []EventName
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, _, err := parseEventTime(record[0])
+		if err != nil {
+			return nil, err
+		}
+		end, isDate, err := parseEventTime(record[1])
+		if err != nil {
+			return nil, err
+		}
+		if isDate {
+			end = end.Add(24*time.Hour - time.Nanosecond)
+		}
+		names = append(names, EventName{Start: start, End: end, Name: strings.TrimSpace(record[2])})
+	}
+}
+
+// parseEventTime parses a time in an event names file, returning if it was
+// a date with no time component.
+func parseEventTime(value string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	for _, format := range eventTimeFormats {
+		if timestamp, err := time.Parse(format, value); err == nil {
+			return timestamp, format == "2006-01-02", nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("events: invalid time %q", value)
+}
+
+// GetEventTagValue gets an `Event.*` tag value.
+func GetEventTagValue(meta *FileMetadata, tag string, properties ...string) (string, error) {
+	if meta.Event == nil {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("file is not part of an event"))
+	}
+	if len(properties) > 0 {
+		switch properties[0] {
+		case "Index":
+			if len(properties) > 1 && properties[1] == "Within" {
+				return fmt.Sprintf("%06d", meta.EventIndex), nil
+			}
+			return fmt.Sprintf("%06d", meta.Event.Index), nil
+		case "Start":
+			return TimestampProp(meta.Event.Start, properties[1:]...), nil
+		case "End":
+			return TimestampProp(meta.Event.End, properties[1:]...), nil
+		case "Name":
+			if len(meta.Event.Name) == 0 {
+				return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("event has no name"))
+			}
+			return meta.Event.Name, nil
+		case "Size":
+			return fmt.Sprintf("%d", len(meta.Event.Files)), nil
+		}
+	}
+	return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("unknown property %q", strings.Join(properties, ".")))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestClusterEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	ceremony := time.Date(2016, 8, 12, 16, 0, 0, 0, time.UTC)
+	metas := []*FileMetadata{
+		{CaptureTime: ceremony.Add(8 * time.Hour)},
+		{CaptureTime: ceremony},
+		{CaptureTime: ceremony.Add(4 * time.Hour)},
+		{CaptureTime: ceremony.Add(5 * time.Hour)},
+		{CaptureTime: ceremony.Add(6*time.Hour + 30*time.Minute)},
+		{CaptureTime: ceremony.Add(9 * time.Hour)},
+		{CaptureTime: ceremony.Add(48 * time.Hour)},
+	}
+	names, err := ParseEventNames(strings.NewReader("# start, end, name\n2016-08-12,2016-08-12,Smith Wedding\n"))
+	assert.Nil(err)
+
+	events := ClusterEvents(metas, DefaultEventGap, 0, names)
+	assert.Len(events, 3)
+
+	// the reception runs past midnight but stays one event.
+	assert.Equal(1, metas[1].Event.Index)
+	assert.Equal(2, metas[2].Event.Index)
+	assert.Equal(metas[2].Event, metas[5].Event)
+	assert.Equal(4, metas[0].EventIndex)
+	assert.Equal(3, metas[6].Event.Index)
+
+	assert.Equal("Smith Wedding", events[0].Name)
+	assert.Equal("Smith Wedding", events[1].Name)
+	assert.Equal("", events[2].Name)
+
+	value, err := GetEventTagValue(metas[5], "Event", "Start", "Day")
+	assert.Nil(err)
+	assert.Equal("12", value)
+	value, err = GetEventTagValue(metas[5], "Event", "Index", "Within")
+	assert.Nil(err)
+	assert.Equal("000005", value)
+	_, err = GetEventTagValue(metas[6], "Event", "Name")
+	assert.True(IsMissingTagError(err))
+}
+
+func TestClusterEventsDistance(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Date(2016, 8, 12, 16, 0, 0, 0, time.UTC)
+	chicago := ExifTags{"GPSLatitude": `["41/1","52/1","0/1"]`, "GPSLatitudeRef": "N", "GPSLongitude": `["87/1","37/1","0/1"]`, "GPSLongitudeRef": "W"}
+	evanston := ExifTags{"GPSLatitude": `["42/1","2/1","0/1"]`, "GPSLatitudeRef": "N", "GPSLongitude": `["87/1","41/1","0/1"]`, "GPSLongitudeRef": "W"}
+	metas := []*FileMetadata{
+		{CaptureTime: start, Exif: chicago},
+		{CaptureTime: start.Add(time.Minute), Exif: chicago},
+		{CaptureTime: start.Add(30 * time.Minute), Exif: evanston},
+		{CaptureTime: start.Add(31 * time.Minute)},
+	}
+
+	assert.Len(ClusterEvents(metas, DefaultEventGap, 0, nil), 1)
+	assert.Len(ClusterEvents(metas, DefaultEventGap, 5, nil), 2)
+	assert.Equal(metas[2].Event, metas[3].Event)
+}
+
+func TestParseEventNamesInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParseEventNames(strings.NewReader("last week,2016-08-12,Party\n"))
+	assert.NotNil(err)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// BodySerialNumber is the exif 2.3 serial number of the camera body, which
+// the exif package doesn't read on its own.
+const BodySerialNumber exif.FieldName = "BodySerialNumber"
+
+// exif23Fields are the exif 2.3 fields of the exif sub-ifd read by
+// exif23Parser.
+var exif23Fields = map[uint16]exif.FieldName{
+	0xA431: BodySerialNumber,
+}
+
+func init() {
+	exif.RegisterParsers(exif23Parser{})
+}
+
+// exif23Parser reads the exif 2.3 fields the exif package leaves out. It runs
+// after the exif package's own parser, which reports a sub-ifd that can't be
+// decoded, so it skips such a sub-ifd quietly.
+type exif23Parser struct{}
+
+// Parse implements exif.Parser.
+func (exif23Parser) Parse(x *exif.Exif) error {
+	pointer, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return nil
+	}
+	offset, err := pointer.Int64(0)
+	if err != nil {
+		return nil
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err = r.Seek(offset, 0); err != nil {
+		return nil
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return nil
+	}
+	x.LoadTags(dir, exif23Fields, false)
+	return nil
+}
+
+// NewExifTags returns the exif fields of decoded exif data rendered as strings.
+func NewExifTags(exifData *exif.Exif) ExifTags {
+	tags := ExifTags{}
+	if exifData == nil {
+		return tags
+	}
+	exifData.Walk(tags)
+	return tags
+}
+
+// ExifTags is the set of exif fields for a file, rendered as strings.
+// It is what is extracted from each file and what is cached between runs.
+type ExifTags map[string]string
+
+// Walk implements exif.Walker.
+// The maker note is skipped as it is an opaque, often large, binary blob.
+func (et ExifTags) Walk(name exif.FieldName, tag *tiff.Tag) error {
+	if name == exif.MakerNote {
+		return nil
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		// numeric and rational fields are rendered with their default formatting,
+		// less the quotes around single rationals.
+		value = tag.String()
+		if tag.Count == 1 {
+			value = strings.Trim(value, `"`)
+		}
+	}
+	et[string(name)] = value
+	return nil
+}
+
+// Get returns the value for a field, or a exif.TagNotPresentError.
+func (et ExifTags) Get(name exif.FieldName) (string, error) {
+	if value, hasValue := et[string(name)]; hasValue {
+		return value, nil
+	}
+	return "", exif.TagNotPresentError(name)
+}
+
+// GetFloat returns the value for a numeric or rational field as a float.
+func (et ExifTags) GetFloat(name exif.FieldName) (float64, error) {
+	value, err := et.Get(name)
+	if err != nil {
+		return 0, err
+	}
+	return ParseRational(value)
+}
+
+// ParseRational parses a rational of the form `n/d`, or a plain number.
+func ParseRational(value string) (float64, error) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if parts := strings.SplitN(value, "/", 2); len(parts) == 2 {
+		numerator, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return 0, err
+		}
+		denominator, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		if denominator == 0 {
+			return 0, fmt.Errorf("rational %q has a zero denominator", value)
+		}
+		return numerator / denominator, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// LatLong returns the gps coordinates in degrees, negative for south and west.
+func (et ExifTags) LatLong() (lat, long float64, err error) {
+	lat, err = et.coordinate(exif.GPSLatitude, exif.GPSLatitudeRef, "S")
+	if err != nil {
+		return
+	}
+	long, err = et.coordinate(exif.GPSLongitude, exif.GPSLongitudeRef, "W")
+	return
+}
+
+func (et ExifTags) coordinate(field, refField exif.FieldName, negativeRef string) (float64, error) {
+	value, err := et.Get(field)
+	if err != nil {
+		return 0, err
+	}
+	ref, err := et.Get(refField)
+	if err != nil {
+		return 0, err
+	}
+
+	// coordinates are rendered as a list of degrees, minutes and seconds rationals.
+	parts := strings.Split(strings.Trim(value, "[]"), ",")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("exif: invalid coordinate %q", value)
+	}
+	var degrees float64
+	for index, divisor := range []float64{1, 60, 3600} {
+		part, err := ParseRational(parts[index])
+		if err != nil {
+			return 0, err
+		}
+		degrees += part / divisor
+	}
+	if strings.TrimSpace(ref) == negativeRef {
+		degrees = -degrees
+	}
+	return degrees, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func TestExifTagsGet(t *testing.T) {
+	assert := assert.New(t)
+
+	tags := ExifTags{"Make": "Canon"}
+	value, err := tags.Get(exif.Make)
+	assert.Nil(err)
+	assert.Equal("Canon", value)
+
+	_, err = tags.Get(exif.Model)
+	assert.True(exif.IsTagNotPresentError(err))
+}
+
+func TestParseRational(t *testing.T) {
+	assert := assert.New(t)
+
+	value, err := ParseRational("-2/3")
+	assert.Nil(err)
+	assert.True(value < -0.66 && value > -0.67)
+
+	value, err = ParseRational(`"28/10"`)
+	assert.Nil(err)
+	assert.Equal(2.8, value)
+
+	value, err = ParseRational("400")
+	assert.Nil(err)
+	assert.Equal(400.0, value)
+
+	_, err = ParseRational("1/0")
+	assert.NotNil(err)
+}
+
+func TestExifTagsLatLong(t *testing.T) {
+	assert := assert.New(t)
+
+	tags := ExifTags{
+		"GPSLatitude":     `["33/1","51/1","2160/100"]`,
+		"GPSLatitudeRef":  "S",
+		"GPSLongitude":    `["151/1","12/1","3600/100"]`,
+		"GPSLongitudeRef": "E",
+	}
+	lat, long, err := tags.LatLong()
+	assert.Nil(err)
+	assert.True(lat < -33.855 && lat > -33.857)
+	assert.True(long > 151.209 && long < 151.211)
+
+	_, _, err = ExifTags{}.LatLong()
+	assert.NotNil(err)
+}
+
+func TestDecodeExifBodySerialNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	// a little endian tiff whose exif sub-ifd only has a body serial number.
+	var raw bytes.Buffer
+	write := func(values ...interface{}) {
+		for _, value := range values {
+			assert.Nil(binary.Write(&raw, binary.LittleEndian, value))
+		}
+	}
+	write([]byte("II"), uint16(42), uint32(8))
+	write(uint16(1), uint16(0x8769), uint16(4), uint32(1), uint32(26), uint32(0))
+	write(uint16(1), uint16(0xA431), uint16(2), uint32(6), uint32(44), uint32(0))
+	write([]byte("12345\x00"))
+
+	exifData, err := DecodeExif(&raw)
+	assert.Nil(err)
+	tags := NewExifTags(exifData)
+	value, err := tags.Get(BodySerialNumber)
+	assert.Nil(err)
+	assert.Equal("12345", value)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MediaType is a kind of media file.
+type MediaType string
+
+// media types
+const (
+	// MediaTypeJPEG is jpeg images.
+	MediaTypeJPEG MediaType = "jpeg"
+
+	// MediaTypePhoto is every still image format, including jpegs.
+	MediaTypePhoto MediaType = "photo"
+
+	// MediaTypeRaw is camera raw images.
+	MediaTypeRaw MediaType = "raw"
+
+	// MediaTypeVideo is videos.
+	MediaTypeVideo MediaType = "video"
+)
+
+// mediaTypeTIFF is sniffed for tiffs and the tiff based raw formats, which
+// can't be told apart by their first bytes.
+const mediaTypeTIFF MediaType = "tiff"
+
+// DefaultMediaTypes are the media types selected when no filter is given.
+const DefaultMediaTypes = "jpeg"
+
+// mediaTypeExtensions are the lower case file extensions of each media type.
+var mediaTypeExtensions = map[MediaType][]string{
+	MediaTypeJPEG:  {".jpg", ".jpeg", ".jpe"},
+	MediaTypePhoto: {".jpg", ".jpeg", ".jpe", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp", ".heic", ".heif"},
+	MediaTypeRaw:   {".cr2", ".cr3", ".crw", ".nef", ".nrw", ".arw", ".srf", ".sr2", ".dng", ".raf", ".orf", ".rw2", ".pef", ".srw", ".x3f"},
+	MediaTypeVideo: {".mp4", ".m4v", ".mov", ".avi", ".mkv", ".mts", ".m2ts", ".3gp", ".wmv"},
+}
+
+// systemDirs are directories that operating systems and NAS appliances keep
+// their own files in.
+var systemDirs = map[string]bool{
+	"@eaDir":                    true,
+	"#recycle":                  true,
+	"$RECYCLE.BIN":              true,
+	"System Volume Information": true,
+	"lost+found":                true,
+	"__MACOSX":                  true,
+}
+
+// ParseMediaTypes parses a comma separated list of media types.
+func ParseMediaTypes(value string) ([]MediaType, error) {
+	var mediaTypes []MediaType
+	for _, part := range strings.Split(value, ",") {
+		mediaType := MediaType(strings.ToLower(strings.TrimSpace(part)))
+		if len(mediaType) == 0 {
+			continue
+		}
+		if _, isMediaType := mediaTypeExtensions[mediaType]; !isMediaType {
+			return nil, fmt.Errorf("invalid media type %q; must be one of jpeg, photo, raw or video", part)
+		}
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	return mediaTypes, nil
+}
+
+// NewFileFilter returns a new file filter. The pattern is a regular
+// expression matched against the full path, and is ignored if empty. Include
+// and exclude are globs; a file has to match one of the includes, if there are
+// any, and none of the excludes. A file also has to have the extension of one
+// of the media types or, if sniff is set, contents that start like one.
+func NewFileFilter(pattern string, include, exclude []string, mediaTypes []MediaType, sniff bool) (*FileFilter, error) {
+	filter := &FileFilter{Extensions: map[string]bool{}, Sniff: sniff}
+	if len(pattern) > 0 {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.Pattern = regex
+	}
+	for _, glob := range include {
+		regex, err := GlobRegexp(glob)
+		if err != nil {
+			return nil, err
+		}
+		filter.Include = append(filter.Include, regex)
+	}
+	for _, glob := range exclude {
+		regex, err := GlobRegexp(glob)
+		if err != nil {
+			return nil, err
+		}
+		filter.Exclude = append(filter.Exclude, regex)
+	}
+	for _, mediaType := range mediaTypes {
+		filter.MediaTypes = append(filter.MediaTypes, mediaType)
+		for _, extension := range mediaTypeExtensions[mediaType] {
+			filter.Extensions[extension] = true
+		}
+	}
+	return filter, nil
+}
+
+// FileFilter selects the files in a directory that a run operates on.
+type FileFilter struct {
+	Pattern    *regexp.Regexp
+	Include    []*regexp.Regexp
+	Exclude    []*regexp.Regexp
+	MediaTypes []MediaType
+	Extensions map[string]bool
+	Sniff      bool
+
+	// Recursive is set if files in sub directories are selected too.
+	Recursive bool
+}
+
+// MatchesFile returns if a file, at a path relative to the directory being
+// listed, is selected.
+func (ff *FileFilter) MatchesFile(path, relativePath string) bool {
+	if isHidden(filepath.Base(path)) {
+		return false
+	}
+	if ff.Pattern != nil && !ff.Pattern.MatchString(path) {
+		return false
+	}
+	if len(ff.Include) > 0 && !matchesAnyGlob(ff.Include, relativePath) {
+		return false
+	}
+	if matchesAnyGlob(ff.Exclude, relativePath) {
+		return false
+	}
+	if len(ff.MediaTypes) == 0 {
+		return true
+	}
+	extension := strings.ToLower(filepath.Ext(path))
+	if ff.Sniff {
+		if mediaType := SniffMediaType(path); len(mediaType) > 0 {
+			return ff.hasMediaType(mediaType, extension)
+		}
+	}
+	return ff.Extensions[extension]
+}
+
+// SkipsDir returns if a directory, at a path relative to the directory being
+// listed, is skipped; hidden and system directories and excluded directories
+// are skipped.
+func (ff *FileFilter) SkipsDir(relativePath string) bool {
+	name := filepath.Base(relativePath)
+	if relativePath != "." && (isHidden(name) || systemDirs[name]) {
+		return true
+	}
+	return matchesAnyGlob(ff.Exclude, relativePath)
+}
+
+func (ff *FileFilter) hasMediaType(sniffed MediaType, extension string) bool {
+	if sniffed == mediaTypeTIFF {
+		if hasExtension(MediaTypeRaw, extension) {
+			sniffed = MediaTypeRaw
+		} else {
+			sniffed = MediaTypePhoto
+		}
+	}
+	for _, mediaType := range ff.MediaTypes {
+		// jpegs are photos too.
+		if mediaType == sniffed || (mediaType == MediaTypePhoto && sniffed == MediaTypeJPEG) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExtension(mediaType MediaType, extension string) bool {
+	for _, candidate := range mediaTypeExtensions[mediaType] {
+		if candidate == extension {
+			return true
+		}
+	}
+	return false
+}
+
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+func matchesAnyGlob(globs []*regexp.Regexp, relativePath string) bool {
+	relativePath = filepath.ToSlash(relativePath)
+	for _, glob := range globs {
+		if glob.MatchString(relativePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// GlobRegexp compiles a glob to a regular expression. `*` matches within a
+// path segment, `**` matches across segments, and `?` and `[...]` work as in
+// filepath.Match. A glob without a `/` is matched against the file name in
+// any directory.
+func GlobRegexp(glob string) (*regexp.Regexp, error) {
+	glob = filepath.ToSlash(glob)
+	var expression strings.Builder
+	if strings.Contains(glob, "/") {
+		expression.WriteString("^")
+	} else {
+		expression.WriteString("(?:^|/)")
+	}
+	for index := 0; index < len(glob); index++ {
+		switch c := glob[index]; c {
+		case '*':
+			if strings.HasPrefix(glob[index:], "**/") {
+				expression.WriteString("(?:.*/)?")
+				index += 2
+			} else if strings.HasPrefix(glob[index:], "**") {
+				expression.WriteString(".*")
+				index++
+			} else {
+				expression.WriteString("[^/]*")
+			}
+		case '?':
+			expression.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[index:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("glob %q: unterminated character class", glob)
+			}
+			class := glob[index+1 : index+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expression.WriteString("[" + class + "]")
+			index += end
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expression.WriteString("$")
+	return regexp.Compile(expression.String())
+}
+
+// SniffMediaType returns the media type of a file from the magic bytes at
+// the start of its contents, or empty if it is not recognized.
+func SniffMediaType(path string) MediaType {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	header := make([]byte, 16)
+	count, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	return SniffMediaTypeHeader(header[:count])
+}
+
+// SniffMediaTypeHeader returns the media type for the first bytes of a file.
+func SniffMediaTypeHeader(header []byte) MediaType {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return MediaTypeJPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG")),
+		bytes.HasPrefix(header, []byte("GIF8")),
+		bytes.HasPrefix(header, []byte("BM")):
+		return MediaTypePhoto
+	case bytes.HasPrefix(header, []byte("II*\x00")),
+		bytes.HasPrefix(header, []byte("MM\x00*")):
+		return mediaTypeTIFF
+	case bytes.HasPrefix(header, []byte("IIRO")),
+		bytes.HasPrefix(header, []byte("IIU\x00")),
+		bytes.HasPrefix(header, []byte("FUJIFILM")):
+		return MediaTypeRaw
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return MediaTypeVideo
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")):
+		switch string(header[8:12]) {
+		case "WEBP":
+			return MediaTypePhoto
+		case "AVI ":
+			return MediaTypeVideo
+		}
+	case len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")):
+		switch string(header[8:12]) {
+		case "heic", "heix", "heim", "heis", "mif1", "msf1", "avif":
+			return MediaTypePhoto
+		case "crx ":
+			return MediaTypeRaw
+		}
+		return MediaTypeVideo
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func writeFilterTestTree(assert *assert.Assertions, dir string) {
+	files := map[string]string{
+		"a.jpg":             "\xFF\xD8\xFFa",
+		"B.JPG":             "\xFF\xD8\xFFb",
+		"c.jpeg":            "\xFF\xD8\xFFc",
+		"d.jpg.bak":         "\xFF\xD8\xFFd",
+		"png.jpg":           "\x89PNG\r\n\x1a\n",
+		".hidden.jpg":       "\xFF\xD8\xFFh",
+		"@eaDir/x.jpg":      "\xFF\xD8\xFFx",
+		".thumbnails/y.jpg": "\xFF\xD8\xFFy",
+		"sub/e.jpg":         "\xFF\xD8\xFFe",
+		"sub/raw.CR2":       "II*\x00raw",
+		"sub/clip.mov":      "\x00\x00\x00\x14ftypqt  ",
+		"skip/f.jpg":        "\xFF\xD8\xFFf",
+	}
+	for name, contents := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(os.MkdirAll(filepath.Dir(filePath), 0755))
+		assert.Nil(ioutil.WriteFile(filePath, []byte(contents), 0644))
+	}
+}
+
+func filterTestFiles(assert *assert.Assertions, dir string, filter *FileFilter) []string {
+	files, err := FilesInDirectoryWithFilter(dir, filter)
+	assert.Nil(err)
+	var names []string
+	for _, file := range files {
+		relativePath, err := filepath.Rel(dir, file)
+		assert.Nil(err)
+		names = append(names, filepath.ToSlash(relativePath))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFilesInDirectoryWithFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename-filter")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	writeFilterTestTree(assert, dir)
+
+	filter, err := NewFileFilter("", nil, []string{"skip"}, []MediaType{MediaTypeJPEG}, false)
+	assert.Nil(err)
+	assert.Equal([]string{"B.JPG", "a.jpg", "c.jpeg", "png.jpg"}, filterTestFiles(assert, dir, filter))
+	filter.Recursive = true
+	assert.Equal([]string{"B.JPG", "a.jpg", "c.jpeg", "png.jpg", "sub/e.jpg"}, filterTestFiles(assert, dir, filter))
+
+	filter, err = NewFileFilter("", nil, nil, []MediaType{MediaTypeJPEG}, true)
+	assert.Nil(err)
+	filter.Recursive = true
+	assert.Equal([]string{"B.JPG", "a.jpg", "c.jpeg", "d.jpg.bak", "skip/f.jpg", "sub/e.jpg"}, filterTestFiles(assert, dir, filter))
+
+	filter, err = NewFileFilter("", []string{"sub/**"}, nil, []MediaType{MediaTypeRaw, MediaTypeVideo}, true)
+	assert.Nil(err)
+	filter.Recursive = true
+	assert.Equal([]string{"sub/clip.mov", "sub/raw.CR2"}, filterTestFiles(assert, dir, filter))
+
+	filter, err = NewFileFilter(`[a-c]\.`, []string{"*.jp*g"}, nil, nil, false)
+	assert.Nil(err)
+	assert.Equal([]string{"a.jpg", "c.jpeg"}, filterTestFiles(assert, dir, filter))
+}
+
+func TestGlobRegexp(t *testing.T) {
+	assert := assert.New(t)
+
+	matches := func(glob, path string) bool {
+		regex, err := GlobRegexp(glob)
+		assert.Nil(err)
+		return regex.MatchString(path)
+	}
+	assert.True(matches("*.jpg", "a.jpg"))
+	assert.True(matches("*.jpg", "sub/a.jpg"))
+	assert.False(matches("*.jpg", "a.jpg.bak"))
+	assert.True(matches("sub/*.jpg", "sub/a.jpg"))
+	assert.False(matches("sub/*.jpg", "sub/deeper/a.jpg"))
+	assert.True(matches("sub/**/*.jpg", "sub/a.jpg"))
+	assert.True(matches("sub/**/*.jpg", "sub/deeper/a.jpg"))
+	assert.True(matches("IMG_[0-9]???.jpg", "IMG_1234.jpg"))
+	assert.False(matches("IMG_[!0-9]*.jpg", "IMG_1234.jpg"))
+
+	_, err := GlobRegexp("IMG_[0-9")
+	assert.NotNil(err)
+}
+
+func TestSniffMediaTypeHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(MediaTypeJPEG, SniffMediaTypeHeader([]byte("\xFF\xD8\xFF\xE1")))
+	assert.Equal(MediaTypePhoto, SniffMediaTypeHeader([]byte("\x89PNG\r\n\x1a\n")))
+	assert.Equal(MediaTypePhoto, SniffMediaTypeHeader([]byte("\x00\x00\x00\x18ftypheic")))
+	assert.Equal(MediaTypeRaw, SniffMediaTypeHeader([]byte("\x00\x00\x00\x18ftypcrx ")))
+	assert.Equal(MediaTypeVideo, SniffMediaTypeHeader([]byte("\x00\x00\x00\x18ftypisom")))
+	assert.Equal(MediaTypeVideo, SniffMediaTypeHeader([]byte("RIFF\x00\x00\x00\x00AVI LIST")))
+	assert.Equal(mediaTypeTIFF, SniffMediaTypeHeader([]byte("II*\x00")))
+	assert.Equal(MediaType(""), SniffMediaTypeHeader([]byte("plain text")))
+}
+
+func TestParseMediaTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	mediaTypes, err := ParseMediaTypes("photo, RAW,video")
+	assert.Nil(err)
+	assert.Equal([]MediaType{MediaTypePhoto, MediaTypeRaw, MediaTypeVideo}, mediaTypes)
+
+	_, err = ParseMediaTypes("photo,audio")
+	assert.NotNil(err)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileInode returns the inode number for file info.
+func FileInode(info os.FileInfo) uint64 {
+	if stat, isStat := info.Sys().(*syscall.Stat_t); isStat {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// FileInode returns the inode number for file info; windows does not expose
+// one through os.FileInfo.
+func FileInode(info os.FileInfo) uint64 {
+	return 0
+}
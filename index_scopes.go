@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// index scopes
+const (
+	// IndexScopeCamera indexes files per camera make, model and body serial
+	// number; files without a serial number are indexed per make and model.
+	IndexScopeCamera = "camera"
+
+	// IndexScopeDirectory indexes files per source directory.
+	IndexScopeDirectory = "directory"
+
+	// IndexScopeHour indexes files per capture hour.
+	IndexScopeHour = "hour"
+
+	// IndexScopeWeek indexes files per ISO week of capture.
+	IndexScopeWeek = "week"
+
+	// IndexScopeEvent indexes files per event.
+	IndexScopeEvent = "event"
+)
+
+// GetIndexTagValue gets an `Index` tag value. With a `scope` attribute it is
+// the index of the file among the files that share its scope key, e.g.
+// `{Index scope=camera}` or `{Index scope="{Model}_{DateTimeOriginal.Year}"}`;
+// otherwise it is the index of the file in the run.
+func GetIndexTagValue(collector *DateIndexCollector, meta *FileMetadata, tag string, attributes map[string]string, properties ...string) (string, error) {
+	if len(properties) > 0 {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("unknown property %q", strings.Join(properties, ".")))
+	}
+
+	scope := attributes["scope"]
+	if len(scope) == 0 {
+		return fmt.Sprintf("%06d", collector.Len()), nil
+	}
+
+	// a file is only counted once per scope, however many times the scope is used.
+	if index, hasIndex := meta.ScopedIndexes[scope]; hasIndex {
+		return fmt.Sprintf("%06d", index), nil
+	}
+	key, err := IndexScopeKey(collector, meta, scope)
+	if err != nil {
+		return "", err
+	}
+	index := collector.IncrementScope(scope, key)
+	if meta.ScopedIndexes == nil {
+		meta.ScopedIndexes = map[string]int{}
+	}
+	meta.ScopedIndexes[scope] = index
+	return fmt.Sprintf("%06d", index), nil
+}
+
+// IndexScopeKey returns the key for a file within a scope; either one of the
+// named scopes or a pattern rendered for the file.
+func IndexScopeKey(collector *DateIndexCollector, meta *FileMetadata, scope string) (string, error) {
+	switch scope {
+	case IndexScopeCamera:
+		return cameraKey(meta), nil
+	case IndexScopeDirectory:
+		return filepath.Dir(meta.Path), nil
+	case IndexScopeHour:
+		return meta.CaptureTime.Format("2006-01-02T15"), nil
+	case IndexScopeWeek:
+		year, week := meta.CaptureTime.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), nil
+	case IndexScopeEvent:
+		if meta.Event == nil {
+			return "", NewFileError(ErrorKindMissingTag, meta.Path, "Index", fmt.Errorf("file is not part of an event"))
+		}
+		return strconv.Itoa(meta.Event.Index), nil
+	}
+	if strings.Contains(scope, "{") {
+		return RenderPattern(collector, meta, scope)
+	}
+	return "", NewFileError(ErrorKindMissingTag, meta.Path, "Index", fmt.Errorf("unknown index scope %q", scope))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestIndexScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	captureTime := time.Date(2016, 8, 12, 14, 0, 0, 0, time.UTC)
+	models := []string{"5D", "7D", "5D", "5D", "7D"}
+	collector := NewDateIndexCollector()
+	pattern := `{Model}_{Index scope="{Model}_{DateTimeOriginal.Year}"}_{Index scope=camera}_{Index}`
+
+	var names []string
+	for index, model := range models {
+		meta := &FileMetadata{
+			Path:        "/photos/" + string(rune('a'+index)) + ".jpg",
+			CaptureTime: captureTime.Add(time.Duration(index) * time.Second),
+			Exif: ExifTags{
+				"Make":             "Canon",
+				"Model":            model,
+				"DateTimeOriginal": "2016:08:12 14:00:00",
+			},
+		}
+		collector.Add(meta.CaptureTime)
+		name, err := RenderPattern(collector, meta, pattern)
+		assert.Nil(err)
+		names = append(names, name)
+	}
+
+	assert.Equal("5D_000001_000001_000001", names[0])
+	assert.Equal("7D_000001_000001_000002", names[1])
+	assert.Equal("5D_000002_000002_000003", names[2])
+	assert.Equal("5D_000003_000003_000004", names[3])
+	assert.Equal("7D_000002_000002_000005", names[4])
+}
+
+func TestIndexScopeCameraSerial(t *testing.T) {
+	assert := assert.New(t)
+
+	collector := NewDateIndexCollector()
+	var indexes []string
+	for _, serial := range []string{"A123", "B456", "A123", ""} {
+		meta := &FileMetadata{Exif: ExifTags{"Make": "Canon", "Model": "5D"}}
+		if len(serial) > 0 {
+			meta.Exif["BodySerialNumber"] = serial
+		}
+		index, err := GetIndexTagValue(collector, meta, "Index", map[string]string{"scope": IndexScopeCamera})
+		assert.Nil(err)
+		indexes = append(indexes, index)
+	}
+	assert.Equal([]string{"000001", "000001", "000002", "000001"}, indexes)
+}
+
+func TestIndexScopeUnknown(t *testing.T) {
+	assert := assert.New(t)
+
+	collector := NewDateIndexCollector()
+	_, err := GetIndexTagValue(collector, &FileMetadata{}, "Index", map[string]string{"scope": "fortnight"})
+	assert.True(IsMissingTagError(err))
+
+	_, err = GetIndexTagValue(collector, &FileMetadata{}, "Index", map[string]string{"scope": IndexScopeEvent})
+	assert.True(IsMissingTagError(err))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SeedIndexes raises the index counters of a collector past the indexes of
+// files that already exist under the output pattern's directory, so new files
+// continue numbering after an existing library instead of colliding with it.
+// Files that are part of the run are excluded, and only directories as deep
+// as the pattern's that aren't skipped by the file filter are walked. It
+// returns the number of existing files that matched the pattern.
+func SeedIndexes(collector *DateIndexCollector, pattern string, exclude []string, fileFilter *FileFilter, cache *MetadataCache) (int, error) {
+	matcher, err := NewPatternMatcher(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	excluded := map[string]bool{}
+	for _, filePath := range exclude {
+		if absolutePath, err := filepath.Abs(filePath); err == nil {
+			excluded[absolutePath] = true
+		}
+	}
+
+	if fileFilter == nil {
+		fileFilter = &FileFilter{}
+	}
+
+	var seeded int
+	directory := PatternDirectory(pattern)
+	depth := patternDepth(pattern)
+	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == directory {
+				return nil
+			}
+			return NewFileError(ErrorKindIO, path, "", err)
+		}
+		if info.IsDir() {
+			relativePath, err := filepath.Rel(directory, path)
+			if err != nil {
+				return NewFileError(ErrorKindIO, path, "", err)
+			}
+			if relativePath == "." {
+				return nil
+			}
+			if strings.Count(filepath.ToSlash(relativePath), "/") >= depth || fileFilter.SkipsDir(relativePath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		values, matches := matcher.Match(path)
+		if !matches {
+			return nil
+		}
+		absolutePath, err := filepath.Abs(path)
+		if err != nil || excluded[absolutePath] {
+			return nil
+		}
+		seedIndexesFromFile(collector, ReadFileMetadata(absolutePath, cache), values)
+		seeded++
+		return nil
+	})
+	return seeded, err
+}
+
+// patternDepth returns how many directories below `PatternDirectory` the files
+// of an output pattern are written to.
+func patternDepth(pattern string) int {
+	parsed, err := ParsePattern(pattern)
+	if err != nil {
+		return 0
+	}
+	var depth int
+	for index, node := range parsed.Nodes {
+		// the separators of the leading literal are part of the pattern's directory.
+		if index == 0 || node.Tag != nil {
+			continue
+		}
+		depth += strings.Count(filepath.ToSlash(node.Literal), "/")
+	}
+	return depth
+}
+
+// seedIndexesFromFile seeds the collector with the index values parsed from an
+// existing file's name. Files without a capture time are bucketed by their
+// modification time, as they would have been with the fallback error policy.
+func seedIndexesFromFile(collector *DateIndexCollector, meta *FileMetadata, values map[string]string) {
+	if meta.Info == nil {
+		return
+	}
+	if meta.Err != nil {
+		meta.CaptureTime = meta.Info.ModTime()
+	}
+
+	for tag, value := range values {
+		if !IsIndexTag(tag) {
+			continue
+		}
+		index, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		tagName, attributes, _ := ParseTagAttributes(tag)
+		switch tagName {
+		case "File.IndexByCaptureYear":
+			collector.SeedYear(meta.CaptureTime, index)
+		case "File.IndexByCaptureMonth":
+			collector.SeedMonth(meta.CaptureTime, index)
+		case "File.IndexByCaptureDate":
+			collector.SeedDay(meta.CaptureTime, index)
+		default:
+			if scope := attributes["scope"]; len(scope) > 0 {
+				if key, err := IndexScopeKey(collector, meta, scope); err == nil {
+					collector.SeedScope(scope, key, index)
+				}
+				continue
+			}
+			collector.SeedCount(index)
+		}
+	}
+}
+
+// ReadIndexCounters reads a persisted index counter store, returning an empty
+// collector if the store does not exist yet.
+func ReadIndexCounters(path string) (*DateIndexCollector, error) {
+	collector := NewDateIndexCollector()
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return collector, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(contents, collector); err != nil {
+		return nil, fmt.Errorf("counters: %s is corrupt: %v", path, err)
+	}
+
+	// buckets missing from the store are reset so they can be incremented.
+	empty := NewDateIndexCollector()
+	if collector.ByYear == nil {
+		collector.ByYear = empty.ByYear
+	}
+	if collector.ByMonth == nil {
+		collector.ByMonth = empty.ByMonth
+	}
+	if collector.ByDay == nil {
+		collector.ByDay = empty.ByDay
+	}
+	if collector.ByScope == nil {
+		collector.ByScope = empty.ByScope
+	}
+	return collector, nil
+}
+
+// SaveIndexCounters persists the index counters of a collector.
+func SaveIndexCounters(path string, collector *DateIndexCollector) error {
+	contents, err := json.Marshal(collector)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so an interrupted save can't corrupt the store.
+	tempPath := path + ".tmp"
+	if err = ioutil.WriteFile(tempPath, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
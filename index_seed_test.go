@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestSeedIndexes(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename-seed")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	day := time.Date(2016, 8, 12, 9, 0, 0, 0, time.Local)
+	for _, name := range []string{"20160812_000001.jpg", "20160812_000140.jpg", "20160812_000002.jpg", "notes.txt"} {
+		filePath := filepath.Join(dir, name)
+		assert.Nil(ioutil.WriteFile(filePath, []byte("not a jpeg"), 0644))
+		assert.Nil(os.Chtimes(filePath, day, day))
+	}
+	inRun := filepath.Join(dir, "20160812_000500.jpg")
+	assert.Nil(ioutil.WriteFile(inRun, []byte("not a jpeg"), 0644))
+
+	pattern := filepath.ToSlash(dir) + "/{File.ModTime.Year}{File.ModTime.Month}{File.ModTime.Day}_{File.IndexByCaptureDate}.jpg"
+	collector := NewDateIndexCollector()
+	seeded, err := SeedIndexes(collector, pattern, []string{inRun}, nil, nil)
+	assert.Nil(err)
+	assert.Equal(3, seeded)
+
+	collector.Add(day)
+	assert.Equal(141, collector.GetIndexByDay(day))
+}
+
+func TestSeedIndexesScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename-seed")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "a_000007.jpg"), []byte("not a jpeg"), 0644))
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "a_000003.jpg"), []byte("not a jpeg"), 0644))
+
+	collector := NewDateIndexCollector()
+	_, err = SeedIndexes(collector, dir+"/a_{Index scope=directory}.jpg", nil, nil, nil)
+	assert.Nil(err)
+	assert.Equal(8, collector.IncrementScope(IndexScopeDirectory, dir))
+
+	_, err = SeedIndexes(collector, dir+"/missing/{File.Index}.jpg", nil, nil, nil)
+	assert.Nil(err)
+}
+
+func TestSeedIndexesSkipsDirectories(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename-seed")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"Canon/img_000004.jpg", ".thumbnails/img_000009.jpg", "Sony/img_000020.jpg", "Canon/2016/img_000030.jpg"} {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(os.MkdirAll(filepath.Dir(filePath), 0755))
+		assert.Nil(ioutil.WriteFile(filePath, []byte("not a jpeg"), 0644))
+	}
+
+	exclude, err := GlobRegexp("Sony")
+	assert.Nil(err)
+	collector := NewDateIndexCollector()
+	fileFilter := &FileFilter{Exclude: []*regexp.Regexp{exclude}}
+	seeded, err := SeedIndexes(collector, filepath.ToSlash(dir)+"/{Model}/img_{File.Index}.jpg", nil, fileFilter, nil)
+	assert.Nil(err)
+	assert.Equal(1, seeded)
+	collector.Add(time.Now())
+	assert.Equal(5, collector.Len())
+
+	assert.Equal(0, patternDepth("img_{File.Index}.jpg"))
+	assert.Equal(0, patternDepth("./photos/img_{File.Index}.jpg"))
+	assert.Equal(2, patternDepth("{File.ModTime.Year}/{File.ModTime.Month}/img_{File.Index}.jpg"))
+	assert.Equal(1, patternDepth("/photos/{Model}/img_{File.Index}.jpg"))
+}
+
+func TestIndexCounters(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename-counters")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	countersPath := filepath.Join(dir, "counters.json")
+
+	collector, err := ReadIndexCounters(countersPath)
+	assert.Nil(err)
+	day := time.Date(2016, 8, 12, 9, 0, 0, 0, time.UTC)
+	collector.Add(day)
+	collector.Add(day)
+	collector.IncrementScope(IndexScopeCamera, "Canon")
+	assert.Nil(SaveIndexCounters(countersPath, collector))
+
+	restored, err := ReadIndexCounters(countersPath)
+	assert.Nil(err)
+	assert.Equal(2, restored.Len())
+	assert.Equal(2, restored.GetIndexByMonth(day))
+	restored.Add(day)
+	assert.Equal(3, restored.GetIndexByDay(day))
+	assert.Equal(2, restored.IncrementScope(IndexScopeCamera, "Canon"))
+
+	assert.Nil(ioutil.WriteFile(countersPath, []byte(`{"count":4}`), 0644))
+	restored, err = ReadIndexCounters(countersPath)
+	assert.Nil(err)
+	restored.Add(day)
+	assert.Equal(5, restored.Len())
+	assert.Equal(1, restored.IncrementScope(IndexScopeHour, "2016-08-12T09"))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// inspect formats
+const (
+	// InspectFormatTable prints a table of tags per file.
+	InspectFormatTable = "table"
+
+	// InspectFormatJSON prints a json array of files.
+	InspectFormatJSON = "json"
+)
+
+// InspectedTag is a tag and the value it renders for a file, or the error it
+// fails with.
+type InspectedTag struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+// InspectedFile is every tag of a file.
+type InspectedFile struct {
+	Path  string         `json:"path"`
+	Error string         `json:"error,omitempty"`
+	Tags  []InspectedTag `json:"tags"`
+}
+
+// InspectTagNames returns every tag that can be resolved for a file: its
+// exif fields, the computed tags, the date time properties of both, and the
+// columns of the lookup tables.
+func InspectTagNames(meta *FileMetadata) []string {
+	var names []string
+	withProperties := func(name string, timestamp bool) {
+		names = append(names, name)
+		if timestamp {
+			for _, property := range TimestampProperties {
+				names = append(names, name+"."+property)
+			}
+		}
+	}
+
+	var exifNames []string
+	for name := range meta.Exif {
+		exifNames = append(exifNames, name)
+	}
+	sort.Strings(exifNames)
+	for _, name := range exifNames {
+		_, isTimestamp := timestampFields[exif.FieldName(name)]
+		withProperties(name, isTimestamp)
+	}
+
+	for _, tag := range ComputedTags {
+		withProperties(tag.Name, tag.Timestamp)
+		if tag.Name == "Index" {
+			for _, scope := range []string{IndexScopeCamera, IndexScopeDirectory, IndexScopeHour, IndexScopeWeek, IndexScopeEvent} {
+				names = append(names, "Index scope="+scope)
+			}
+		}
+	}
+
+	var tableNames []string
+	for name := range meta.Lookups {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+	for _, name := range tableNames {
+		for _, column := range meta.Lookups[name].Table.Columns {
+			names = append(names, "Lookup."+name+"."+column)
+		}
+	}
+	return names
+}
+
+// InspectFiles resolves every tag of files. The files are grouped into
+// sequences, events and, if set in the options, similar groups first, and
+// files without a capture time fall back to their modification time, so every
+// tag that can be resolved is.
+func InspectFiles(metas []*FileMetadata, options RenameOptions) []InspectedFile {
+	var grouped []*FileMetadata
+	for _, meta := range metas {
+		if meta.Info == nil {
+			continue
+		}
+		if meta.Err != nil {
+			meta.CaptureTime = meta.Info.ModTime()
+		}
+		grouped = append(grouped, meta)
+	}
+	DetectSequences(grouped, options.SequenceGap)
+	ClusterEvents(grouped, options.EventGap, options.EventDistance, options.EventNames)
+	if options.Similar {
+		ComputePerceptualHashes(grouped, options.Jobs, options.Cache)
+		GroupSimilar(grouped, options.SimilarThreshold)
+	}
+	ApplyLookups(grouped, options.Lookups)
+
+	collector := NewDateIndexCollector()
+	inspected := make([]InspectedFile, 0, len(metas))
+	for _, meta := range metas {
+		file := InspectedFile{Path: meta.Path, Tags: []InspectedTag{}}
+		if meta.Err != nil {
+			file.Error = meta.Err.Error()
+		}
+		if meta.Info == nil {
+			inspected = append(inspected, file)
+			continue
+		}
+
+		collector.Add(meta.CaptureTime)
+		for _, name := range InspectTagNames(meta) {
+			tag := InspectedTag{Tag: name}
+			value, err := GetTagValue(collector, meta, name)
+			if err != nil {
+				tag.Error = inspectError(err)
+			} else {
+				tag.Value = value
+			}
+			file.Tags = append(file.Tags, tag)
+		}
+		inspected = append(inspected, file)
+	}
+	return inspected
+}
+
+// inspectError returns an error without the path of the file it is for.
+func inspectError(err error) string {
+	if fileErr, isFileErr := err.(*FileError); isFileErr && fileErr.Err != nil {
+		return fmt.Sprintf("%s: %v", fileErr.Kind, fileErr.Err)
+	}
+	return err.Error()
+}
+
+// WriteInspectedFiles writes inspected files in a given format.
+func WriteInspectedFiles(w io.Writer, files []InspectedFile, format string) error {
+	switch format {
+	case InspectFormatJSON:
+		{
+			contents, err := json.MarshalIndent(files, "", "\t")
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(contents, '\n'))
+			return err
+		}
+	case InspectFormatTable:
+		{
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			for index, file := range files {
+				if index > 0 {
+					fmt.Fprintln(tw)
+				}
+				fmt.Fprintf(tw, "%s\n", file.Path)
+				if len(file.Error) > 0 {
+					fmt.Fprintf(tw, "  error: %s\n", file.Error)
+				}
+				for _, tag := range file.Tags {
+					if len(tag.Error) > 0 {
+						fmt.Fprintf(tw, "  {%s}\t(%s)\n", tag.Tag, tag.Error)
+						continue
+					}
+					fmt.Fprintf(tw, "  {%s}\t%s\n", tag.Tag, tag.Value)
+				}
+			}
+			return tw.Flush()
+		}
+	}
+	return fmt.Errorf("inspect: invalid format %q; must be one of table or json", format)
+}
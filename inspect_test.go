@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func inspectTestFiles(assert *assert.Assertions, dir string) []InspectedFile {
+	imagePath := filepath.Join(dir, "IMG_0001.jpg")
+	assert.Nil(ioutil.WriteFile(imagePath, []byte("image"), 0644))
+	info, err := os.Stat(imagePath)
+	assert.Nil(err)
+
+	exifTags := ExifTags{"Make": "Canon", "Model": "EOS", "DateTimeOriginal": "2016:08:12 14:00:00"}
+	captureTime, err := GetExifCaptureTime(exifTags)
+	assert.Nil(err)
+	metas := []*FileMetadata{
+		{Path: imagePath, Info: info, Exif: exifTags, CaptureTime: captureTime},
+		{Path: filepath.Join(dir, "missing.jpg"), Err: NewFileError(ErrorKindIO, "", "", os.ErrNotExist)},
+	}
+	return InspectFiles(metas, RenameOptions{SequenceGap: DefaultSequenceGap, EventGap: DefaultEventGap})
+}
+
+func TestInspectFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	files := inspectTestFiles(assert, dir)
+	assert.Len(files, 2)
+	assert.Empty(files[0].Error)
+	assert.NotEmpty(files[1].Error)
+	assert.Empty(files[1].Tags)
+
+	values := map[string]InspectedTag{}
+	for _, tag := range files[0].Tags {
+		values[tag.Tag] = tag
+	}
+	assert.Equal("Canon", values["Make"].Value)
+	assert.Equal("08", values["DateTimeOriginal.Month"].Value)
+	assert.Equal("2016", values["Event.Start.Year"].Value)
+	assert.Equal("000001", values["Index scope=camera"].Value)
+	assert.Equal("IMG_0001.jpg", values["File.Name"].Value)
+	assert.Equal("jpg", values["File.Extension"].Value)
+	assert.Equal("single", values["Sequence.Kind"].Value)
+	assert.Empty(values["Group.Id"].Value)
+	assert.NotEmpty(values["Group.Id"].Error)
+	assert.False(strings.Contains(values["Group.Id"].Error, dir))
+}
+
+func TestWriteInspectedFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	files := inspectTestFiles(assert, dir)
+
+	var table bytes.Buffer
+	assert.Nil(WriteInspectedFiles(&table, files, InspectFormatTable))
+	assert.True(strings.Contains(table.String(), "{DateTimeOriginal.Year}"))
+	assert.True(strings.Contains(table.String(), "  error: "))
+
+	var output bytes.Buffer
+	assert.Nil(WriteInspectedFiles(&output, files, InspectFormatJSON))
+	var decoded []InspectedFile
+	assert.Nil(json.Unmarshal(output.Bytes(), &decoded))
+	assert.Equal(files, decoded)
+
+	assert.NotNil(WriteInspectedFiles(&output, files, "xml"))
+}
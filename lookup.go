@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LookupMatch determines how a file is matched with the rows of a lookup
+// table.
+type LookupMatch string
+
+// lookup matches
+const (
+	// LookupMatchExact matches the row whose key column is the key tag value.
+	LookupMatchExact LookupMatch = "exact"
+
+	// LookupMatchRange matches the first row whose `start` and `end` columns,
+	// inclusive, contain the key tag value; both dates and numbers.
+	LookupMatchRange LookupMatch = "range"
+
+	// LookupMatchPrefix matches the row whose key column is the longest prefix
+	// of the key tag value.
+	LookupMatchPrefix LookupMatch = "prefix"
+)
+
+const (
+	// DefaultLookupColumn is the column rows are matched on by exact and prefix
+	// lookups.
+	DefaultLookupColumn = "key"
+
+	// lookupStartColumn and lookupEndColumn are the columns rows are matched on
+	// by range lookups.
+	lookupStartColumn = "start"
+	lookupEndColumn   = "end"
+)
+
+// ParseLookupMatch parses a lookup match.
+func ParseLookupMatch(value string) (LookupMatch, error) {
+	switch match := LookupMatch(strings.ToLower(strings.TrimSpace(value))); match {
+	case LookupMatchExact, LookupMatchRange, LookupMatchPrefix:
+		return match, nil
+	}
+	return "", fmt.Errorf("invalid lookup match %q; must be one of exact, range or prefix", value)
+}
+
+// LookupTable is a csv or json table whose rows are joined to files by a tag,
+// and whose columns are used as `{Lookup.table.column}`.
+type LookupTable struct {
+	Name  string
+	Path  string
+	Match LookupMatch
+	// Key is the tag matched with the rows; for range lookups it defaults to
+	// the capture time.
+	Key string
+	// Column is the column matched by exact and prefix lookups.
+	Column  string
+	Columns []string
+	Rows    []map[string]string
+
+	ranges []lookupRange
+}
+
+// lookupRange is the parsed `start` and `end` of a row of a range lookup.
+type lookupRange struct {
+	start, end           time.Time
+	startValue, endValue float64
+}
+
+// ReadLookupTable reads the lookup table of a `--lookup` value, a table name
+// followed by its attributes, e.g.
+// `schedule file=schedule.csv match=range` or
+// `bodies file=bodies.json key=Model`.
+func ReadLookupTable(spec string) (*LookupTable, error) {
+	name, attributes, err := ParseTagAttributes(spec)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: %v", err)
+	}
+	if len(name) == 0 || strings.ContainsAny(name, ".{}|") {
+		return nil, fmt.Errorf("lookup: invalid table name %q", name)
+	}
+	table := &LookupTable{
+		Name:   name,
+		Path:   attributes["file"],
+		Match:  LookupMatchExact,
+		Key:    attributes["key"],
+		Column: DefaultLookupColumn,
+	}
+	for attribute, value := range attributes {
+		switch attribute {
+		case "file", "key":
+		case "match":
+			if table.Match, err = ParseLookupMatch(value); err != nil {
+				return nil, fmt.Errorf("lookup %s: %v", name, err)
+			}
+		case "column":
+			table.Column = value
+		default:
+			return nil, fmt.Errorf("lookup %s: unknown attribute %q; attributes are file, match, key and column", name, attribute)
+		}
+	}
+	if len(table.Path) == 0 {
+		return nil, fmt.Errorf("lookup %s: missing file=", name)
+	}
+	if len(table.Key) == 0 && table.Match != LookupMatchRange {
+		return nil, fmt.Errorf("lookup %s: missing key=; only range lookups default to the capture time", name)
+	}
+
+	file, err := os.Open(table.Path)
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s: %v", name, err)
+	}
+	defer file.Close()
+	if strings.ToLower(filepath.Ext(table.Path)) == ".json" {
+		table.Columns, table.Rows, err = ParseLookupJSON(file)
+	} else {
+		table.Columns, table.Rows, err = ParseLookupCSV(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s: %s: %v", name, table.Path, err)
+	}
+	if err = table.index(); err != nil {
+		return nil, fmt.Errorf("lookup %s: %s: %v", name, table.Path, err)
+	}
+	return table, nil
+}
+
+// ParseLookupCSV parses a csv lookup table; the first row names the columns.
+// Lines starting with `#` are ignored.
+func ParseLookupCSV(r io.Reader) ([]string, []map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("missing header row")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]string, len(header))
+	for index, column := range header {
+		columns[index] = strings.TrimSpace(column)
+	}
+
+	var rows []map[string]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return columns, rows, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		row := map[string]string{}
+		for index, value := range record {
+			row[columns[index]] = strings.TrimSpace(value)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// ParseLookupJSON parses a json lookup table; either an array of objects, or
+// an object of objects whose keys are the `key` column. Values that aren't
+// strings are formatted, and nulls are left out.
+func ParseLookupJSON(r io.Reader) ([]string, []map[string]string, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, nil, err
+	}
+
+	var objects []interface{}
+	var keys []string
+	switch value := document.(type) {
+	case []interface{}:
+		objects = value
+	case map[string]interface{}:
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			objects = append(objects, value[key])
+		}
+	default:
+		return nil, nil, fmt.Errorf("expected an array or an object of rows")
+	}
+
+	seen := map[string]bool{}
+	var columns []string
+	var rows []map[string]string
+	for index, object := range objects {
+		fields, isObject := object.(map[string]interface{})
+		if !isObject {
+			return nil, nil, fmt.Errorf("row %d is not an object", index+1)
+		}
+		row := map[string]string{}
+		if keys != nil {
+			row[DefaultLookupColumn] = keys[index]
+		}
+		for column, value := range fields {
+			switch value.(type) {
+			case nil:
+				continue
+			case map[string]interface{}, []interface{}:
+				return nil, nil, fmt.Errorf("row %d: column %q is not a string or a number", index+1, column)
+			}
+			row[column] = fmt.Sprint(value)
+		}
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.Strings(columns)
+	return columns, rows, nil
+}
+
+// index checks the table has the columns it is matched on, and parses the
+// ranges of a range lookup; every range is either dates or numbers.
+func (lt *LookupTable) index() error {
+	hasColumn := map[string]bool{}
+	for _, column := range lt.Columns {
+		hasColumn[column] = true
+	}
+	if lt.Match != LookupMatchRange {
+		if !hasColumn[lt.Column] {
+			return fmt.Errorf("no %q column", lt.Column)
+		}
+		return nil
+	}
+	if !hasColumn[lookupStartColumn] || !hasColumn[lookupEndColumn] {
+		return fmt.Errorf("range lookups need %q and %q columns", lookupStartColumn, lookupEndColumn)
+	}
+
+	byTime := lt.isTimeRange()
+	lt.ranges = make([]lookupRange, len(lt.Rows))
+	for index, row := range lt.Rows {
+		if byTime {
+			start, _, startErr := parseEventTime(row[lookupStartColumn])
+			end, isDate, endErr := parseEventTime(row[lookupEndColumn])
+			if startErr != nil || endErr != nil {
+				return fmt.Errorf("row %d: %q to %q is not a range of dates like the first row", index+1, row[lookupStartColumn], row[lookupEndColumn])
+			}
+			if isDate {
+				end = end.Add(24*time.Hour - time.Nanosecond)
+			}
+			lt.ranges[index] = lookupRange{start: start, end: end}
+			continue
+		}
+		startValue, startErr := ParseRational(row[lookupStartColumn])
+		endValue, endErr := ParseRational(row[lookupEndColumn])
+		if startErr != nil || endErr != nil {
+			return fmt.Errorf("row %d: %q to %q is not a range of dates or of numbers", index+1, row[lookupStartColumn], row[lookupEndColumn])
+		}
+		lt.ranges[index] = lookupRange{startValue: startValue, endValue: endValue}
+	}
+	return nil
+}
+
+// isTimeRange returns if a range lookup is by time, by its first row.
+func (lt *LookupTable) isTimeRange() bool {
+	if len(lt.Rows) == 0 {
+		return false
+	}
+	_, _, err := parseEventTime(lt.Rows[0][lookupStartColumn])
+	return err == nil
+}
+
+// Find returns the row of the table that matches a file.
+func (lt *LookupTable) Find(meta *FileMetadata) (map[string]string, error) {
+	if lt.Match == LookupMatchRange && len(lt.Key) == 0 {
+		if row := lt.findTime(meta.CaptureTime); row != nil {
+			return row, nil
+		}
+		return nil, fmt.Errorf("no row matches the capture time %s", meta.CaptureTime.Format(timestampFormat))
+	}
+	key, err := GetTagValue(NewDateIndexCollector(), meta, lt.Key)
+	if err != nil {
+		return nil, err
+	}
+	key = strings.TrimSpace(key)
+
+	switch lt.Match {
+	case LookupMatchRange:
+		{
+			if lt.isTimeRange() {
+				timestamp, err := parseWhereTimestamp(key)
+				if err != nil {
+					return nil, fmt.Errorf("%s is %q, which is not a date", lt.Key, key)
+				}
+				if row := lt.findTime(timestamp); row != nil {
+					return row, nil
+				}
+			} else {
+				value, err := ParseRational(key)
+				if err != nil {
+					return nil, fmt.Errorf("%s is %q, which is not a number", lt.Key, key)
+				}
+				for index, bounds := range lt.ranges {
+					if value >= bounds.startValue && value <= bounds.endValue {
+						return lt.Rows[index], nil
+					}
+				}
+			}
+		}
+	case LookupMatchPrefix:
+		{
+			var match map[string]string
+			for _, row := range lt.Rows {
+				prefix := row[lt.Column]
+				if len(prefix) > 0 && strings.HasPrefix(key, prefix) && (match == nil || len(prefix) > len(match[lt.Column])) {
+					match = row
+				}
+			}
+			if match != nil {
+				return match, nil
+			}
+		}
+	default:
+		{
+			for _, row := range lt.Rows {
+				if row[lt.Column] == key {
+					return row, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("no row matches %s %q", lt.Key, key)
+}
+
+// findTime returns the first row whose range contains a time, or nil.
+func (lt *LookupTable) findTime(timestamp time.Time) map[string]string {
+	for index, bounds := range lt.ranges {
+		if !timestamp.Before(bounds.start) && !timestamp.After(bounds.end) {
+			return lt.Rows[index]
+		}
+	}
+	return nil
+}
+
+// LookupResult is the row of a lookup table that matched a file, or the
+// reason none did.
+type LookupResult struct {
+	Table *LookupTable
+	Row   map[string]string
+	Err   error
+}
+
+// ApplyLookups finds the row of each lookup table that matches each file.
+func ApplyLookups(metas []*FileMetadata, tables []*LookupTable) {
+	if len(tables) == 0 {
+		return
+	}
+	for _, meta := range metas {
+		meta.Lookups = map[string]LookupResult{}
+		for _, table := range tables {
+			row, err := table.Find(meta)
+			meta.Lookups[table.Name] = LookupResult{Table: table, Row: row, Err: err}
+		}
+	}
+}
+
+// LookupRows returns the matched row of each lookup table of a file; tables
+// with no matching row are left out.
+func LookupRows(meta *FileMetadata) map[string]map[string]string {
+	rows := map[string]map[string]string{}
+	for name, result := range meta.Lookups {
+		if result.Err == nil {
+			rows[name] = result.Row
+		}
+	}
+	return rows
+}
+
+// GetLookupTagValue gets a `Lookup.table.column` tag value; a column of the
+// row of a lookup table that matched the file.
+func GetLookupTagValue(meta *FileMetadata, tag string, properties ...string) (string, error) {
+	if len(properties) < 2 {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("lookup tags take a table and a column, e.g. Lookup.schedule.client"))
+	}
+	fullTag := tag + "." + strings.Join(properties, ".")
+	result, hasTable := meta.Lookups[properties[0]]
+	if !hasTable {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, fullTag, fmt.Errorf("no lookup table %q", properties[0]))
+	}
+	if result.Err != nil {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, fullTag, result.Err)
+	}
+	// column names may contain dots.
+	value, hasValue := result.Row[strings.Join(properties[1:], ".")]
+	if !hasValue {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, fullTag, fmt.Errorf("the row has no %q column", strings.Join(properties[1:], ".")))
+	}
+	return value, nil
+}
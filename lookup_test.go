@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func writeLookupTable(assert *assert.Assertions, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestParseLookupCSV(t *testing.T) {
+	assert := assert.New(t)
+
+	columns, rows, err := ParseLookupCSV(strings.NewReader("# bodies\nkey, owner, since\nA123, Ann, 2015\nB456, Bo,\n"))
+	assert.Nil(err)
+	assert.Equal([]string{"key", "owner", "since"}, columns)
+	assert.Len(rows, 2)
+	assert.Equal(map[string]string{"key": "A123", "owner": "Ann", "since": "2015"}, rows[0])
+	assert.Equal("", rows[1]["since"])
+
+	_, _, err = ParseLookupCSV(strings.NewReader(""))
+	assert.NotNil(err)
+	_, _, err = ParseLookupCSV(strings.NewReader("key,owner\nA123\n"))
+	assert.NotNil(err)
+}
+
+func TestParseLookupJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	columns, rows, err := ParseLookupJSON(strings.NewReader(`[{"key": "A123", "owner": "Ann", "since": 2015, "note": null}, {"key": "B456", "owner": "Bo"}]`))
+	assert.Nil(err)
+	assert.Equal([]string{"key", "owner", "since"}, columns)
+	assert.Len(rows, 2)
+	assert.Equal("2015", rows[0]["since"])
+	_, hasNote := rows[0]["note"]
+	assert.False(hasNote)
+
+	columns, rows, err = ParseLookupJSON(strings.NewReader(`{"B456": {"owner": "Bo"}, "A123": {"owner": "Ann"}}`))
+	assert.Nil(err)
+	assert.Equal([]string{"key", "owner"}, columns)
+	assert.Equal(map[string]string{"key": "A123", "owner": "Ann"}, rows[0])
+	assert.Equal(map[string]string{"key": "B456", "owner": "Bo"}, rows[1])
+
+	_, _, err = ParseLookupJSON(strings.NewReader(`"rows"`))
+	assert.NotNil(err)
+	_, _, err = ParseLookupJSON(strings.NewReader(`[{"key": ["A123"]}]`))
+	assert.NotNil(err)
+}
+
+func TestReadLookupTableErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	bodies := writeLookupTable(assert, dir, "bodies.csv", "key,owner\nA123,Ann\n")
+	schedule := writeLookupTable(assert, dir, "schedule.csv", "start,end,client\n2016-08-12,2016-08-13,Smith\nsoon,later,Jones\n")
+
+	for _, spec := range []string{
+		"bodies key=Make",
+		"bodies file=" + bodies,
+		"bodies file=" + bodies + " key=Make match=fuzzy",
+		"bodies file=" + bodies + " key=Make colour=red",
+		"bodies file=" + bodies + " key=Make column=serial",
+		"bodies file=" + bodies + " match=range",
+		"schedule file=" + schedule + " match=range",
+		"no.dots file=" + bodies + " key=Make",
+		"missing file=" + filepath.Join(dir, "missing.csv") + " key=Make",
+	} {
+		_, err := ReadLookupTable(spec)
+		assert.NotNil(err, spec)
+	}
+}
+
+func TestLookupTableFind(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	writeLookupTable(assert, dir, "bodies.json", `{"A123": {"owner": "Ann"}, "B456": {"owner": "Bo"}}`)
+	writeLookupTable(assert, dir, "studios.csv", "prefix,studio\nNIKON,north\nNIKON CORP,south\n")
+	writeLookupTable(assert, dir, "schedule.csv", "start,end,client\n2016-08-12,2016-08-12,Smith\n2016-08-13 09:00,2016-08-13 12:00,Jones\n")
+	writeLookupTable(assert, dir, "iso.csv", "start,end,light\n0,400,bright\n401,6400,dim\n")
+
+	bodies, err := ReadLookupTable("bodies file=" + filepath.Join(dir, "bodies.json") + " key=Model")
+	assert.Nil(err)
+	studios, err := ReadLookupTable("studios file=" + filepath.Join(dir, "studios.csv") + " key=Make match=prefix column=prefix")
+	assert.Nil(err)
+	schedule, err := ReadLookupTable("schedule file=" + filepath.Join(dir, "schedule.csv") + " match=range")
+	assert.Nil(err)
+	iso, err := ReadLookupTable("iso file=" + filepath.Join(dir, "iso.csv") + " key=ISOSpeedRatings match=range")
+	assert.Nil(err)
+
+	meta := &FileMetadata{
+		Path:        "a.jpg",
+		CaptureTime: time.Date(2016, 8, 12, 23, 30, 0, 0, time.UTC),
+		Exif:        ExifTags{"Make": "NIKON CORPORATION", "Model": "B456", "ISOSpeedRatings": "800"},
+	}
+	row, err := bodies.Find(meta)
+	assert.Nil(err)
+	assert.Equal("Bo", row["owner"])
+	row, err = studios.Find(meta)
+	assert.Nil(err)
+	assert.Equal("south", row["studio"])
+	row, err = schedule.Find(meta)
+	assert.Nil(err)
+	assert.Equal("Smith", row["client"])
+	row, err = iso.Find(meta)
+	assert.Nil(err)
+	assert.Equal("dim", row["light"])
+
+	meta.CaptureTime = time.Date(2016, 8, 13, 13, 0, 0, 0, time.UTC)
+	_, err = schedule.Find(meta)
+	assert.NotNil(err)
+	meta.Exif["Model"] = "C789"
+	_, err = bodies.Find(meta)
+	assert.NotNil(err)
+	meta.Exif["ISOSpeedRatings"] = "auto"
+	_, err = iso.Find(meta)
+	assert.NotNil(err)
+}
+
+func TestGetLookupTagValue(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	writeLookupTable(assert, dir, "bodies.csv", "key,owner,owner.email\nB456,Bo,bo@example.com\n")
+	bodies, err := ReadLookupTable("bodies file=" + filepath.Join(dir, "bodies.csv") + " key=Model")
+	assert.Nil(err)
+
+	metas := []*FileMetadata{
+		{Path: "a.jpg", Exif: ExifTags{"Model": "B456"}},
+		{Path: "b.jpg", Exif: ExifTags{"Model": "C789"}},
+	}
+	ApplyLookups(metas, []*LookupTable{bodies})
+
+	value, err := GetTagValue(NewDateIndexCollector(), metas[0], "Lookup.bodies.owner")
+	assert.Nil(err)
+	assert.Equal("Bo", value)
+	value, err = GetTagValue(NewDateIndexCollector(), metas[0], "Lookup.bodies.owner.email")
+	assert.Nil(err)
+	assert.Equal("bo@example.com", value)
+	assert.Equal(map[string]map[string]string{"bodies": {"key": "B456", "owner": "Bo", "owner.email": "bo@example.com"}}, LookupRows(metas[0]))
+
+	for _, tag := range []string{"Lookup.bodies", "Lookup.cameras.owner", "Lookup.bodies.phone"} {
+		_, err = GetTagValue(NewDateIndexCollector(), metas[0], tag)
+		assert.True(IsMissingTagError(err), tag)
+	}
+	_, err = GetTagValue(NewDateIndexCollector(), metas[1], "Lookup.bodies.owner")
+	assert.True(IsMissingTagError(err))
+	assert.True(strings.Contains(err.Error(), "no row matches"))
+	assert.Empty(LookupRows(metas[1]))
+}
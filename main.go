@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"strconv"
 	"time"
 
@@ -26,8 +25,9 @@ const (
 	// DefaultWorkDir is the default working directory.
 	DefaultWorkDir = "."
 
-	// DefaultFileInputFilter is the default file input filter.
-	DefaultFileInputFilter = ".jpg"
+	// DefaultFileInputFilter is the default file input filter regex; files
+	// are selected by media type by default instead.
+	DefaultFileInputFilter = ""
 
 	// DefaultFileOutputPattern is the default output pattern for the file.`
 	DefaultFileOutputPattern = "{DateTimeDigitized.Year}{DateTimeDigitized.Month}{DateTimeDigitized.Day}_{Make}_{File.IndexByCaptureDate}.{File.Extension}"
@@ -35,19 +35,55 @@ const (
 
 // flags
 var (
-	flagWorkDir           = flag.String("workdir", DefaultWorkDir, "The working directory for operations.")
-	flagInputFileFilter   = flag.String("filter", DefaultFileInputFilter, "The input file filter.")
-	flagOutputFilePattern = flag.String("output", DefaultFileOutputPattern, "The file output pattern.")
-	flagRecursive         = flag.Bool("recursive", false, "The filesystem visitor should recurse to sub directories.")
-	flagDryRun            = flag.Bool("dryrun", false, "The print the output, do not rename/move the files.")
+	// allFlags holds every flag; each command parses a flag set of the ones
+	// it uses.
+	allFlags = flag.NewFlagSet("image-rename", flag.ContinueOnError)
+
+	flagConfig            = allFlags.String("config", "", "The config file; defaults to image-rename.toml or .yaml in the working directory or the user config directory.")
+	flagProfile           = allFlags.String("profile", "", "The config file profile to apply.")
+	flagWorkDir           = allFlags.String("workdir", DefaultWorkDir, "The working directory for operations.")
+	flagInputFileFilter   = allFlags.String("filter", DefaultFileInputFilter, "A regular expression the full path of input files must match.")
+	flagInclude           = newStringsFlag("include", "A glob input files must match; may be repeated.")
+	flagExclude           = newStringsFlag("exclude", "A glob of input files or directories to skip; may be repeated.")
+	flagMediaTypes        = allFlags.String("type", DefaultMediaTypes, "The comma separated media types of input files; any of jpeg, photo, raw or video.")
+	flagSniff             = allFlags.Bool("sniff", false, "Detect the media type of input files from their contents rather than their extension.")
+	flagOutputFilePattern = allFlags.String("output", DefaultFileOutputPattern, "The file output pattern.")
+	flagTemplate          = allFlags.String("template", "", "A Go text/template output format to use instead of the output pattern.")
+	flagScript            = allFlags.String("script", "", "A starlark script defining rename(tags), which returns the target name or extra Script.* tags for each file.")
+	flagPlugin            = allFlags.String("plugin", "", "An executable, with space separated arguments that can be double quoted, that provides Ext.* tags; it is sent a json line per file on stdin and answers each with a json line of tags.")
+	flagPluginTimeout     = allFlags.Duration("plugin-timeout", DefaultPluginTimeout, "How long the plugin has to answer each file.")
+	flagDest              = allFlags.String("dest", "", "The directory the output pattern is relative to; defaults to the current directory.")
+	flagRecursive         = allFlags.Bool("recursive", false, "The filesystem visitor should recurse to sub directories.")
+	flagDryRun            = allFlags.Bool("dryrun", false, "The print the output, do not rename/move the files.")
+	flagJobs              = allFlags.Int("jobs", runtime.NumCPU(), "The number of files to read metadata from in parallel.")
+	flagCacheFile         = allFlags.String("cache", "", "The metadata cache file; defaults to a file in the user cache directory.")
+	flagCacheHash         = allFlags.Bool("cache-hash", false, "Include a content hash of each file in the metadata cache key.")
+	flagNoCache           = allFlags.Bool("no-cache", false, "Do not read or write the metadata cache.")
+	flagDuplicates        = allFlags.String("duplicates", string(DuplicatePolicyNone), "The duplicate policy; one of none, skip, move, hardlink or delete.")
+	flagYes               = allFlags.Bool("yes", false, "Do not prompt for confirmation before deleting files.")
+	flagSimilar           = allFlags.Bool("similar", false, "Group visually similar images using a perceptual hash of their thumbnails.")
+	flagSimilarThreshold  = allFlags.Int("similar-threshold", DefaultSimilarThreshold, "The maximum number of differing perceptual hash bits for images to be grouped.")
+	flagSequenceGap       = allFlags.Duration("sequence-gap", DefaultSequenceGap, "The maximum time between shots in a burst, bracket or panorama sequence.")
+	flagEventGap          = allFlags.Duration("event-gap", DefaultEventGap, "The time between shots that starts a new event.")
+	flagEventDistance     = allFlags.Float64("event-distance", 0, "The distance in kilometers between shots that starts a new event; 0 disables.")
+	flagEventNames        = allFlags.String("events", "", "A csv file of `start,end,name` rows naming events.")
+	flagLookups           = newStringsFlag("lookup", "A lookup table whose columns are used as Lookup.table.column tags, e.g. `schedule file=schedule.csv match=range`; may be repeated.")
+	flagContinue          = allFlags.Bool("continue", false, "Continue index numbering after files in the output directory that already match the output pattern.")
+	flagCounters          = allFlags.String("counters", "", "A file to persist index counters in between runs.")
+	flagWhere             = allFlags.String("where", "", "An expression over tag values that selects the files to rename, e.g. `Make == \"Canon\"`.")
+	flagRenumber          = allFlags.Bool("renumber", false, "Rename files even if their names already match the output pattern.")
+	flagOnError           = allFlags.String("on-error", string(ErrorPolicyAbort), "The error policy; one of abort, skip or fallback.")
+	flagFormat            = allFlags.String("format", InspectFormatTable, "The format to print tags in; table or json.")
+	flagInterval          = allFlags.Duration("interval", DefaultWatchInterval, "How often to check the working directory for new files.")
 )
 
 // fieldTypes
 var (
-	timestampFields = map[exif.FieldName]bool{
-		exif.DateTime:          true,
-		exif.DateTimeOriginal:  true,
-		exif.DateTimeDigitized: true,
+	// timestampFields maps each timestamp field to its sub-second field.
+	timestampFields = map[exif.FieldName]exif.FieldName{
+		exif.DateTime:          exif.SubSecTime,
+		exif.DateTimeOriginal:  exif.SubSecTimeOriginal,
+		exif.DateTimeDigitized: exif.SubSecTimeDigitized,
 	}
 )
 
@@ -55,10 +91,51 @@ const (
 	timestampFormat = `2006:01:02 15:04:05`
 )
 
+// stringsFlag is a flag that can be repeated.
+type stringsFlag []string
+
+// newStringsFlag defines a repeatable string flag.
+func newStringsFlag(name, usage string) *stringsFlag {
+	var value stringsFlag
+	allFlags.Var(&value, name, usage)
+	return &value
+}
+
+// String returns the values joined by commas.
+func (sf *stringsFlag) String() string {
+	if sf == nil {
+		return ""
+	}
+	return strings.Join(*sf, ",")
+}
+
+// Set adds a value.
+func (sf *stringsFlag) Set(value string) error {
+	*sf = append(*sf, value)
+	return nil
+}
+
 // --------------------------------------------------------------------------------
 // Arguments
 // --------------------------------------------------------------------------------
 
+// ArgsConfigFile returns the config file path, or empty if it should be
+// looked for.
+func ArgsConfigFile() string {
+	if flagConfig != nil {
+		return *flagConfig
+	}
+	return ""
+}
+
+// ArgsProfile returns the config file profile, or empty for none.
+func ArgsProfile() string {
+	if flagProfile != nil {
+		return *flagProfile
+	}
+	return ""
+}
+
 // ArgsWorkDir returns the default working directory.
 func ArgsWorkDir() string {
 	if flagWorkDir == nil {
@@ -80,6 +157,52 @@ func ArgsInputFileFilter() string {
 	return DefaultFileInputFilter
 }
 
+// ArgsInclude returns the globs input files must match.
+func ArgsInclude() []string {
+	if flagInclude != nil {
+		return *flagInclude
+	}
+	return nil
+}
+
+// ArgsExclude returns the globs of input files and directories to skip.
+func ArgsExclude() []string {
+	if flagExclude != nil {
+		return *flagExclude
+	}
+	return nil
+}
+
+// ArgsMediaTypes returns the media types of input files.
+func ArgsMediaTypes() ([]MediaType, error) {
+	if flagMediaTypes != nil {
+		return ParseMediaTypes(*flagMediaTypes)
+	}
+	return ParseMediaTypes(DefaultMediaTypes)
+}
+
+// ArgsSniff returns if media types are detected from file contents.
+func ArgsSniff() bool {
+	if flagSniff != nil {
+		return *flagSniff
+	}
+	return false
+}
+
+// ArgsFileFilter returns the input file filter.
+func ArgsFileFilter() (*FileFilter, error) {
+	mediaTypes, err := ArgsMediaTypes()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := NewFileFilter(ArgsInputFileFilter(), ArgsInclude(), ArgsExclude(), mediaTypes, ArgsSniff())
+	if err != nil {
+		return nil, err
+	}
+	filter.Recursive = ArgsRecursive()
+	return filter, nil
+}
+
 // ArgsOutputFilePattern is the output file pattern.
 func ArgsOutputFilePattern() string {
 	if flagOutputFilePattern != nil {
@@ -88,6 +211,62 @@ func ArgsOutputFilePattern() string {
 	return DefaultFileOutputPattern
 }
 
+// ArgsDest returns the destination directory, or empty for the current
+// directory.
+func ArgsDest() string {
+	if flagDest != nil {
+		return *flagDest
+	}
+	return ""
+}
+
+// ArgsTemplate returns the output template, or empty to use the output pattern.
+func ArgsTemplate() string {
+	if flagTemplate != nil {
+		return *flagTemplate
+	}
+	return ""
+}
+
+// ArgsScript returns the rename script file, or empty for none.
+func ArgsScript() string {
+	if flagScript != nil {
+		return *flagScript
+	}
+	return ""
+}
+
+// ArgsPlugin returns the tag plugin command line, or empty for none.
+func ArgsPlugin() string {
+	if flagPlugin != nil {
+		return *flagPlugin
+	}
+	return ""
+}
+
+// ArgsPluginTimeout returns how long the tag plugin has to answer each file.
+func ArgsPluginTimeout() time.Duration {
+	if flagPluginTimeout != nil {
+		return *flagPluginTimeout
+	}
+	return DefaultPluginTimeout
+}
+
+// ArgsDestinationPattern is the output file pattern within the destination
+// directory.
+func ArgsDestinationPattern() string {
+	return DestinationPattern(ArgsDest(), ArgsOutputFilePattern())
+}
+
+// DestinationPattern returns an output pattern within a destination
+// directory; absolute patterns are left as is.
+func DestinationPattern(dest, pattern string) string {
+	if len(dest) == 0 || filepath.IsAbs(pattern) || strings.HasPrefix(pattern, "/") {
+		return pattern
+	}
+	return strings.TrimSuffix(filepath.ToSlash(dest), "/") + "/" + pattern
+}
+
 // ArgsRecursive returns if the filesystem visitor should be recursive.
 func ArgsRecursive() bool {
 	if flagRecursive != nil {
@@ -104,6 +283,262 @@ func ArgsDryRun() bool {
 	return false
 }
 
+// ArgsJobs returns the number of metadata workers.
+func ArgsJobs() int {
+	if flagJobs != nil && *flagJobs > 0 {
+		return *flagJobs
+	}
+	return runtime.NumCPU()
+}
+
+// ArgsCacheFile returns the metadata cache file path.
+func ArgsCacheFile() string {
+	if flagCacheFile != nil && len(*flagCacheFile) > 0 {
+		return *flagCacheFile
+	}
+	return DefaultMetadataCachePath()
+}
+
+// ArgsCacheHash returns if the metadata cache key should include a content hash.
+func ArgsCacheHash() bool {
+	if flagCacheHash != nil {
+		return *flagCacheHash
+	}
+	return false
+}
+
+// ArgsNoCache returns if the metadata cache is disabled.
+func ArgsNoCache() bool {
+	if flagNoCache != nil {
+		return *flagNoCache
+	}
+	return false
+}
+
+// ArgsMetadataCache returns the metadata cache, or nil if it is disabled.
+func ArgsMetadataCache() (*MetadataCache, error) {
+	if ArgsNoCache() {
+		return nil, nil
+	}
+	return ReadMetadataCache(ArgsCacheFile(), ArgsCacheHash())
+}
+
+// ArgsContinue returns if indexes should continue after existing files.
+func ArgsContinue() bool {
+	if flagContinue != nil {
+		return *flagContinue
+	}
+	return false
+}
+
+// ArgsCountersFile returns the index counter store path, or empty if counters
+// are not persisted.
+func ArgsCountersFile() string {
+	if flagCounters != nil {
+		return *flagCounters
+	}
+	return ""
+}
+
+// ArgsIndexCollector returns the index collector, read from the counter store
+// if there is one.
+func ArgsIndexCollector() (*DateIndexCollector, error) {
+	if countersFile := ArgsCountersFile(); len(countersFile) > 0 {
+		return ReadIndexCounters(countersFile)
+	}
+	return NewDateIndexCollector(), nil
+}
+
+// ArgsWhere returns the where expression, or nil if files are not selected by
+// their metadata.
+func ArgsWhere() (*WhereExpression, error) {
+	if flagWhere != nil && len(*flagWhere) > 0 {
+		return ParseWhere(*flagWhere)
+	}
+	return nil, nil
+}
+
+// ArgsRenumber returns if files already named by the output pattern should be
+// renamed anyway.
+func ArgsRenumber() bool {
+	if flagRenumber != nil {
+		return *flagRenumber
+	}
+	return false
+}
+
+// ArgsOnError returns the error policy.
+func ArgsOnError() (ErrorPolicy, error) {
+	if flagOnError != nil {
+		return ParseErrorPolicy(*flagOnError)
+	}
+	return ErrorPolicyAbort, nil
+}
+
+// ArgsDuplicates returns the duplicate policy.
+func ArgsDuplicates() (DuplicatePolicy, error) {
+	if flagDuplicates != nil {
+		return ParseDuplicatePolicy(*flagDuplicates)
+	}
+	return DuplicatePolicyNone, nil
+}
+
+// ArgsYes returns if confirmation prompts should be skipped.
+func ArgsYes() bool {
+	if flagYes != nil {
+		return *flagYes
+	}
+	return false
+}
+
+// ArgsSimilar returns if visually similar images should be grouped.
+func ArgsSimilar() bool {
+	if flagSimilar != nil {
+		return *flagSimilar
+	}
+	return false
+}
+
+// ArgsSimilarThreshold returns the perceptual hash distance threshold.
+func ArgsSimilarThreshold() int {
+	if flagSimilarThreshold != nil {
+		return *flagSimilarThreshold
+	}
+	return DefaultSimilarThreshold
+}
+
+// ArgsSequenceGap returns the maximum time between shots in a sequence.
+func ArgsSequenceGap() time.Duration {
+	if flagSequenceGap != nil {
+		return *flagSequenceGap
+	}
+	return DefaultSequenceGap
+}
+
+// ArgsEventGap returns the time between shots that starts a new event.
+func ArgsEventGap() time.Duration {
+	if flagEventGap != nil {
+		return *flagEventGap
+	}
+	return DefaultEventGap
+}
+
+// ArgsEventDistance returns the distance between shots that starts a new event.
+func ArgsEventDistance() float64 {
+	if flagEventDistance != nil {
+		return *flagEventDistance
+	}
+	return 0
+}
+
+// ArgsEventNames returns the event names, if an event names file was given.
+func ArgsEventNames() ([]EventName, error) {
+	if flagEventNames != nil && len(*flagEventNames) > 0 {
+		return ReadEventNames(*flagEventNames)
+	}
+	return nil, nil
+}
+
+// ArgsLookups returns the lookup tables.
+func ArgsLookups() ([]*LookupTable, error) {
+	if flagLookups == nil {
+		return nil, nil
+	}
+	var tables []*LookupTable
+	names := map[string]bool{}
+	for _, spec := range *flagLookups {
+		table, err := ReadLookupTable(spec)
+		if err != nil {
+			return nil, err
+		}
+		if names[table.Name] {
+			return nil, fmt.Errorf("lookup: table %q is given more than once", table.Name)
+		}
+		names[table.Name] = true
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// ArgsFormat returns the format tags are printed in.
+func ArgsFormat() string {
+	if flagFormat != nil {
+		return *flagFormat
+	}
+	return InspectFormatTable
+}
+
+// ArgsInterval returns how often the working directory is checked for new
+// files.
+func ArgsInterval() time.Duration {
+	if flagInterval != nil && *flagInterval > 0 {
+		return *flagInterval
+	}
+	return DefaultWatchInterval
+}
+
+// ArgsRenameOptions returns the rename options for a given working directory.
+func ArgsRenameOptions(workDir string) (RenameOptions, error) {
+	options := RenameOptions{
+		OutputFilePattern: ArgsDestinationPattern(),
+		Dest:              ArgsDest(),
+		Jobs:              ArgsJobs(),
+		DryRun:            ArgsDryRun(),
+		AssumeYes:         ArgsYes(),
+		Similar:           ArgsSimilar(),
+		SimilarThreshold:  ArgsSimilarThreshold(),
+		SequenceGap:       ArgsSequenceGap(),
+		EventGap:          ArgsEventGap(),
+		EventDistance:     ArgsEventDistance(),
+		Renumber:          ArgsRenumber(),
+		DuplicatesDir:     filepath.Join(workDir, DefaultDuplicatesDir),
+		Journal:           filepath.Join(workDir, DefaultRenameJournalFile),
+		UndoLog:           filepath.Join(workDir, DefaultUndoLogFile),
+	}
+
+	var err error
+	if options.OnError, err = ArgsOnError(); err != nil {
+		return options, err
+	}
+	if options.Duplicates, err = ArgsDuplicates(); err != nil {
+		return options, err
+	}
+	if options.EventNames, err = ArgsEventNames(); err != nil {
+		return options, err
+	}
+	if options.Lookups, err = ArgsLookups(); err != nil {
+		return options, err
+	}
+	if options.Cache, err = ArgsMetadataCache(); err != nil {
+		return options, err
+	}
+	if options.Collector, err = ArgsIndexCollector(); err != nil {
+		return options, err
+	}
+	if options.Where, err = ArgsWhere(); err != nil {
+		return options, err
+	}
+	if templateSource := ArgsTemplate(); len(templateSource) > 0 {
+		if ArgsContinue() {
+			return options, fmt.Errorf("--continue can't be used with --template; names made by a template can't be matched")
+		}
+		if options.Template, err = ParseOutputTemplate(DestinationPattern(ArgsDest(), templateSource)); err != nil {
+			return options, err
+		}
+	}
+	if scriptFile := ArgsScript(); len(scriptFile) > 0 {
+		if options.Script, err = LoadScript(scriptFile); err != nil {
+			return options, err
+		}
+	}
+	if plugin := ArgsPlugin(); len(plugin) > 0 {
+		if options.Plugin, err = NewTagPlugin(plugin, ArgsPluginTimeout()); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
 // --------------------------------------------------------------------------------
 // Property Formatters
 // --------------------------------------------------------------------------------
@@ -124,6 +559,16 @@ func TimestampProp(timestamp time.Time, properties ...string) string {
 			return fmt.Sprintf("%02d", timestamp.Minute())
 		case "Second":
 			return fmt.Sprintf("%02d", timestamp.Second())
+		case "Week":
+			_, week := timestamp.ISOWeek()
+			return fmt.Sprintf("%02d", week)
+		case "WeekYear":
+			year, _ := timestamp.ISOWeek()
+			return strconv.Itoa(year)
+		case "Millisecond":
+			return fmt.Sprintf("%03d", timestamp.Nanosecond()/int(time.Millisecond))
+		case "Microsecond":
+			return fmt.Sprintf("%06d", timestamp.Nanosecond()/int(time.Microsecond))
 		case "Nanosecond":
 			return strconv.Itoa(timestamp.Nanosecond())
 		case "Unix":
@@ -163,60 +608,83 @@ func FileProp(fileMeta os.FileInfo, properties ...string) string {
 	return value
 }
 
-// ExtractFileOutputTags extracts the tags from a file pattern.
+// ExtractFileOutputTags extracts the tags from a file pattern. Patterns are
+// checked with ParsePattern before they're used; one that doesn't parse has
+// no tags.
 func ExtractFileOutputTags(filePattern string) []string {
+	pattern, err := ParsePattern(filePattern)
+	if err != nil {
+		return nil
+	}
 	var tags []string
-	state := 0
-	var tag *bytes.Buffer
-	for _, r := range filePattern {
-		switch state {
-		case 0:
-			{
-				if r == rune('{') {
-					tag = bytes.NewBuffer([]byte{})
-					state = 1
-				}
-			}
-		case 1:
-			{
-				if r == rune('}') {
-					tags = append(tags, tag.String())
-					state = 0
-				}
-				tag.WriteRune(r)
-			}
-		}
+	for _, tag := range pattern.Tags() {
+		tags = append(tags, tag.Source)
 	}
 	return tags
 }
 
-// FilesInDirectoryWithFilter returns the files in a directory with a given filter.
-func FilesInDirectoryWithFilter(directoryPath, fileFilter string) []string {
+// FilesInDirectoryWithFilter returns the files in a directory with a given filter,
+// skipping hidden, system and any excluded directories. Sub directories are
+// only visited if the filter is recursive.
+func FilesInDirectoryWithFilter(directoryPath string, fileFilter *FileFilter, excludeDirs ...string) ([]string, error) {
 	var files []string
-
-	fileFilterRegex := regexp.MustCompile(fileFilter)
-
-	filepath.Walk(directoryPath, func(path string, f os.FileInfo, err error) error {
+	err := filepath.Walk(directoryPath, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return NewFileError(ErrorKindIO, path, "", err)
+		}
+		relativePath, err := filepath.Rel(directoryPath, path)
+		if err != nil {
+			return NewFileError(ErrorKindIO, path, "", err)
+		}
 		if f.IsDir() {
+			for _, excludeDir := range excludeDirs {
+				if path == excludeDir {
+					return filepath.SkipDir
+				}
+			}
+			if relativePath != "." && !fileFilter.Recursive {
+				return filepath.SkipDir
+			}
+			if fileFilter.SkipsDir(relativePath) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		if fileFilterRegex.MatchString(path) {
+		if fileFilter.MatchesFile(path, relativePath) {
 			files = append(files, path)
 		}
 		return nil
 	})
 
-	return files
+	return files, err
 }
 
 // GetExifData returns exif file meta for a given path.
 func GetExifData(filePath string) (*exif.Exif, error) {
 	fileContents, err := os.Open(filePath)
 	if err != nil {
-		return nil, err
+		return nil, NewFileError(ErrorKindIO, filePath, "", err)
 	}
 	defer fileContents.Close()
-	return exif.Decode(fileContents)
+
+	exifData, err := DecodeExif(fileContents)
+	if err != nil {
+		return nil, AsFileError(filePath, err)
+	}
+	return exifData, nil
+}
+
+// DecodeExif decodes exif data from a reader.
+func DecodeExif(r io.Reader) (*exif.Exif, error) {
+	exifData, err := exif.Decode(r)
+	if err != nil {
+		// sub-ifd failures still leave the primary fields usable.
+		if exifData != nil && !exif.IsCriticalError(err) {
+			return exifData, nil
+		}
+		return nil, NewFileError(ErrorKindNoExif, "", "", err)
+	}
+	return exifData, nil
 }
 
 // ParseTagProperties returns the tag and relevant property.
@@ -228,17 +696,99 @@ func ParseTagProperties(outputTag string) (tag string, properties []string) {
 	return outputTag, nil
 }
 
+// ParseTagAttributes returns the tag and its `key="value"` attributes, e.g.
+// `Index scope="{Model}"`. Values without spaces may be unquoted.
+func ParseTagAttributes(outputTag string) (tag string, attributes map[string]string, err error) {
+	outputTag = strings.TrimSpace(outputTag)
+	space := strings.IndexAny(outputTag, " \t")
+	if space < 0 {
+		return outputTag, nil, nil
+	}
+
+	tag, rest := outputTag[:space], outputTag[space:]
+	attributes = map[string]string{}
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if len(rest) == 0 {
+			return tag, attributes, nil
+		}
+		equals := strings.Index(rest, "=")
+		if equals <= 0 {
+			return tag, nil, fmt.Errorf("tag %q: expected a key=value attribute at %q", outputTag, rest)
+		}
+		key := strings.TrimSpace(rest[:equals])
+		rest = rest[equals+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return tag, nil, fmt.Errorf("tag %q: unterminated quote in attribute %q", outputTag, key)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		attributes[key] = value
+	}
+}
+
+// SplitOutsideQuotes splits a string on a separator, ignoring separators
+// within double quotes.
+func SplitOutsideQuotes(value string, separator rune) []string {
+	var parts []string
+	var inQuotes bool
+	var start int
+	for index, r := range value {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == separator && !inQuotes:
+			parts = append(parts, value[start:index])
+			start = index + len(string(r))
+		}
+	}
+	return append(parts, value[start:])
+}
+
 // ReplaceTagInPattern replaces a given tag in a given pattern.
 func ReplaceTagInPattern(inputPattern, tag, value string) string {
 	return strings.Replace(inputPattern, "{"+tag+"}", value, -1)
 }
 
+// ReplaceTagsInPattern replaces every given tag in a given pattern in a single
+// pass, so a value or a quoted attribute that contains another tag is left as
+// is, and unescapes the literal braces. Tags that aren't given are left as is.
+func ReplaceTagsInPattern(inputPattern string, tags, values []string) string {
+	pattern, err := ParsePattern(inputPattern)
+	if err != nil {
+		return inputPattern
+	}
+	tagValues := map[string]string{}
+	for index, tag := range tags {
+		tagValues[tag] = values[index]
+	}
+	patternValues := make([]string, 0, len(tags))
+	for _, tag := range pattern.Tags() {
+		value, hasValue := tagValues[tag.Source]
+		if !hasValue {
+			value = "{" + tag.Source + "}"
+		}
+		patternValues = append(patternValues, value)
+	}
+	return pattern.Render(patternValues)
+}
+
 // GetFileTagValue gets a tag value from file metadata.
-func GetFileTagValue(collector *DateIndexCollector, fileCaptureTime time.Time, filePath, tag string, properties ...string) (string, error) {
+func GetFileTagValue(collector *DateIndexCollector, meta *FileMetadata, tag string, properties ...string) (string, error) {
 	var tagValue string
-	fileMeta, err := os.Stat(filePath)
-	if err != nil {
-		return tagValue, err
+	fileMeta, fileCaptureTime := meta.Info, meta.CaptureTime
+	if fileMeta == nil {
+		return tagValue, NewFileError(ErrorKindIO, meta.Path, tag, fmt.Errorf("file: no info"))
 	}
 
 	if len(properties) > 0 {
@@ -262,10 +812,25 @@ func GetFileTagValue(collector *DateIndexCollector, fileCaptureTime time.Time, f
 				fileIndex := collector.GetIndexByDay(fileCaptureTime)
 				return fmt.Sprintf("%06d", fileIndex), nil
 			}
+		case "Hash":
+			{
+				hash, err := meta.EnsureHash()
+				if err != nil {
+					return tagValue, err
+				}
+				if len(properties) > 1 && properties[1] == "Short" {
+					return ShortHash(hash), nil
+				}
+				return hash, nil
+			}
 		case "Extension":
 			{
 				return strings.Replace(filepath.Ext(fileMeta.Name()), ".", "", -1), nil
 			}
+		case "Directory":
+			{
+				return filepath.Base(filepath.Dir(meta.Path)), nil
+			}
 		default:
 			{
 				return FileProp(fileMeta, properties...), nil
@@ -277,138 +842,199 @@ func GetFileTagValue(collector *DateIndexCollector, fileCaptureTime time.Time, f
 }
 
 // GetExifTagValue gets a tag value from exif metadata.
-func GetExifTagValue(exifData *exif.Exif, tag string, properties ...string) (string, error) {
+func GetExifTagValue(exifTags ExifTags, tag string, properties ...string) (string, error) {
 	var tagValue string
-	exifTag, err := exifData.Get(exif.FieldName(tag))
-	if err != nil {
-		return tagValue, err
-	}
-
-	stringTagValue, err := exifTag.StringVal()
-	if err != nil {
-		return tagValue, err
+	if exifTags == nil {
+		return tagValue, NewFileError(ErrorKindNoExif, "", tag, fmt.Errorf("exif: no data"))
 	}
 
 	if _, isTimestampField := timestampFields[exif.FieldName(tag)]; isTimestampField {
-		timestamp, err := time.Parse(timestampFormat, stringTagValue)
+		timestamp, err := GetExifTimestamp(exifTags, exif.FieldName(tag))
 		if err != nil {
 			return tagValue, err
 		}
-		if len(properties) > 0 {
-			tagValue = TimestampProp(timestamp, properties[0])
-		}
-	} else {
-		tagValue = stringTagValue
+		return TimestampProp(timestamp, properties...), nil
 	}
 
+	tagValue, err := exifTags.Get(exif.FieldName(tag))
+	if err != nil {
+		return tagValue, NewFileError(ErrorKindMissingTag, "", tag, err)
+	}
 	return tagValue, nil
 }
 
 // GetTagValue returns the tag value for a given fileMeta.
-func GetTagValue(indexCollector *DateIndexCollector, fileCaptureTime time.Time, exifData *exif.Exif, filePath, fileTag string) (string, error) {
+// Alternatives are separated by `|`; an error is returned only if none of the
+// alternatives resolve.
+func GetTagValue(indexCollector *DateIndexCollector, meta *FileMetadata, fileTag string) (string, error) {
 	var tagValue string
-	for _, outputTag := range strings.Split(fileTag, "|") {
-		tag, properties := ParseTagProperties(outputTag)
+	var resolved bool
+	var lastErr error
+	for _, outputTag := range SplitOutsideQuotes(fileTag, '|') {
+		tagName, attributes, err := ParseTagAttributes(outputTag)
+		if err != nil {
+			lastErr = NewFileError(ErrorKindMissingTag, meta.Path, outputTag, err)
+			continue
+		}
+		tag, properties := ParseTagProperties(tagName)
+
+		var value string
 		switch tag {
+		case "Index":
+			value, err = GetIndexTagValue(indexCollector, meta, tag, attributes, properties...)
 		case "File":
-			fileTagValue, err := GetFileTagValue(indexCollector, fileCaptureTime, filePath, tag, properties...)
-			if err != nil {
-				continue
-			}
-			tagValue = fileTagValue
-			break
+			value, err = GetFileTagValue(indexCollector, meta, tag, properties...)
+		case "Group":
+			value, err = GetGroupTagValue(meta, tag, properties...)
+		case "Sequence":
+			value, err = GetSequenceTagValue(meta, tag, properties...)
+		case "Event":
+			value, err = GetEventTagValue(meta, tag, properties...)
+		case "Script":
+			value, err = GetScriptTagValue(meta, tag, properties...)
+		case "Ext":
+			value, err = GetExtTagValue(meta, tag, properties...)
+		case "Lookup":
+			value, err = GetLookupTagValue(meta, tag, properties...)
 		default:
-			exifTagValue, err := GetExifTagValue(exifData, tag, properties...)
-			if err != nil {
-				continue
-			}
-			tagValue = exifTagValue
-			break
+			value, err = GetExifTagValue(meta.Exif, tag, properties...)
+		}
+		if err != nil {
+			lastErr = err
+			continue
 		}
+		tagValue = value
+		resolved = true
+	}
+	if !resolved && lastErr != nil {
+		return tagValue, AsFileError(meta.Path, lastErr)
 	}
 	return tagValue, nil
 }
 
+// RenderPattern replaces every tag in a pattern with its value for a file.
+func RenderPattern(indexCollector *DateIndexCollector, meta *FileMetadata, source string) (string, error) {
+	pattern, err := ParsePattern(source)
+	if err != nil {
+		return source, err
+	}
+	tags := pattern.Tags()
+	values := make([]string, len(tags))
+	for index, tag := range tags {
+		value, err := GetTagValue(indexCollector, meta, tag.Source)
+		if err != nil {
+			return source, err
+		}
+		values[index] = value
+	}
+	return pattern.Render(values), nil
+}
+
 // GetFileCaptureTime returns the capture time for a given image file.
 func GetFileCaptureTime(filePath string) (time.Time, *exif.Exif, error) {
-	var timestamp time.Time
 	exifData, err := GetExifData(filePath)
 	if err != nil {
-		return timestamp, exifData, err
+		return time.Time{}, exifData, err
 	}
-
-	exifTag, err := exifData.Get(exif.DateTimeDigitized)
+	timestamp, err := GetExifCaptureTime(NewExifTags(exifData))
 	if err != nil {
-		exifTag, err = exifData.Get(exif.DateTimeOriginal)
-		if err != nil {
-			exifTag, err = exifData.Get(exif.DateTime)
+		return timestamp, exifData, AsFileError(filePath, err)
+	}
+	return timestamp, exifData, nil
+}
+
+// GetExifCaptureTime returns the capture time from exif data, preferring
+// the digitized time, then the original time, then the modification time.
+func GetExifCaptureTime(exifTags ExifTags) (time.Time, error) {
+	timestamp, err := GetExifTimestamp(exifTags, exif.DateTimeDigitized)
+	if IsMissingTagError(err) {
+		timestamp, err = GetExifTimestamp(exifTags, exif.DateTimeOriginal)
+		if IsMissingTagError(err) {
+			timestamp, err = GetExifTimestamp(exifTags, exif.DateTime)
 		}
 	}
-	if err != nil {
-		return timestamp, exifData, err
+	if IsMissingTagError(err) {
+		return timestamp, NewFileError(ErrorKindMissingTag, "", string(exif.DateTimeDigitized), exif.TagNotPresentError(exif.DateTimeDigitized))
 	}
+	return timestamp, err
+}
 
-	stringTagValue, err := exifTag.StringVal()
+// GetExifTimestamp returns the value of a timestamp field, including the
+// fractional seconds from its sub-second field if present.
+func GetExifTimestamp(exifTags ExifTags, field exif.FieldName) (time.Time, error) {
+	var timestamp time.Time
+	stringTagValue, err := exifTags.Get(field)
 	if err != nil {
-		return timestamp, exifData, err
+		return timestamp, NewFileError(ErrorKindMissingTag, "", string(field), err)
 	}
 	timestamp, err = time.Parse(timestampFormat, stringTagValue)
-	return timestamp, exifData, err
-}
-
-// IncrementCaptureIndex increments the capture index for a file based on
-// its capture time.
-func IncrementCaptureIndex(filePath string, collector *DateIndexCollector) (time.Time, *exif.Exif, error) {
-	timestamp, exifData, err := GetFileCaptureTime(filePath)
 	if err != nil {
-		return timestamp, exifData, err
+		return timestamp, NewFileError(ErrorKindInvalidDate, "", string(field), err)
 	}
-	collector.Add(timestamp)
-	return timestamp, exifData, nil
-}
-
-// ApplyPattern applies the rename pattern to the files.
-func ApplyPattern(files, fileTags []string, outputFilePattern string) error {
-	var collector = NewDateIndexCollector()
-	for _, file := range files {
-		fileCaptureTime, exifData, err := IncrementCaptureIndex(file, collector)
 
-		outputFilename := outputFilePattern
-		for _, tag := range fileTags {
-			value, err := GetTagValue(collector, fileCaptureTime, exifData, file, tag)
-			if err != nil {
-				return err
-			}
-			outputFilename = ReplaceTagInPattern(outputFilename, tag, value)
-		}
-
-		if ArgsDryRun() {
-			fmt.Printf("%s => %s\n", file, outputFilename)
-		} else {
-			err = os.Rename(file, outputFilename)
-			if err != nil {
-				return err
-			}
+	if subSecondField, hasSubSecondField := timestampFields[field]; hasSubSecondField {
+		if subSeconds, err := exifTags.Get(subSecondField); err == nil {
+			timestamp = timestamp.Add(ParseSubSeconds(subSeconds))
 		}
 	}
+	return timestamp, nil
+}
 
-	return nil
+// ParseSubSeconds parses a sub-second field, which holds the digits after the
+// decimal point of the seconds, e.g. `05` is 50 milliseconds. Invalid values
+// are ignored.
+func ParseSubSeconds(value string) time.Duration {
+	digits := strings.TrimSpace(value)
+	if len(digits) == 0 {
+		return 0
+	}
+	if len(digits) > 9 {
+		digits = digits[:9]
+	}
+	nanoseconds, err := strconv.Atoi(digits + strings.Repeat("0", 9-len(digits)))
+	if err != nil || nanoseconds < 0 {
+		return 0
+	}
+	return time.Duration(nanoseconds)
 }
 
-func main() {
-	flag.Parse()
+// applyConfig applies the config file settings and the selected profile to
+// the flags that weren't set on the command line, and expands aliases in the
+// output pattern.
+func applyConfig(flagSet *flag.FlagSet) error {
+	configFile := ArgsConfigFile()
+	if len(configFile) == 0 {
+		configFile = FindConfigFile(ArgsWorkDir())
+	}
+	if len(configFile) == 0 {
+		if profile := ArgsProfile(); len(profile) > 0 {
+			return fmt.Errorf("profile %q: no config file found", profile)
+		}
+		return nil
+	}
 
-	// - get all files in WorkDirAbsolute() that match the input filter
-	workDir, err := ArgsWorkDirAbsolute()
+	config, err := ReadConfig(configFile)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
-	files := FilesInDirectoryWithFilter(workDir, ArgsInputFileFilter())
-	fileTags := ExtractFileOutputTags(ArgsOutputFilePattern())
-
-	err = ApplyPattern(files, fileTags, ArgsOutputFilePattern())
+	settings, aliases, err := config.Profile(ArgsProfile())
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	if err = ApplyConfigSettings(flagSet, settings); err != nil {
+		return fmt.Errorf("%s: %v", configFile, err)
+	}
+	// aliases are only used by the output pattern of commands that have one.
+	if len(aliases) == 0 || flagSet.Lookup("output") == nil {
+		return nil
+	}
+	pattern, err := ExpandAliases(ArgsOutputFilePattern(), aliases)
+	if err != nil {
+		return err
+	}
+	return flagSet.Set("output", pattern)
+}
+
+func main() {
+	os.Exit(RunCommandLine(os.Args[1:]))
 }
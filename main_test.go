@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	assert "github.com/blendlabs/go-assert"
 )
@@ -12,9 +13,9 @@ func TestExtractFileTags(t *testing.T) {
 
 	tags := ExtractFileOutputTags(DefaultFileOutputPattern)
 	assert.Len(tags, 6, fmt.Sprintf("%#v", tags))
-	assert.Equal("DateTime.Year", tags[0])
-	assert.Equal("DateTime.Month", tags[1])
-	assert.Equal("DateTime.Day", tags[2])
+	assert.Equal("DateTimeDigitized.Year", tags[0])
+	assert.Equal("DateTimeDigitized.Month", tags[1])
+	assert.Equal("DateTimeDigitized.Day", tags[2])
 	assert.Equal("Make", tags[3])
 	assert.Equal("File.IndexByCaptureDate", tags[4])
 	assert.Equal("File.Extension", tags[5])
@@ -28,3 +29,101 @@ func TestReplaceTagInPattern(t *testing.T) {
 	assert.Equal("123_{bar}_123", replaced)
 	assert.Equal("123_321_123", ReplaceTagInPattern(replaced, "bar", "321"))
 }
+
+func TestGetExifDataMissingFile(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := GetExifData("does_not_exist.jpg")
+	assert.NotNil(err)
+	assert.True(IsIOError(err))
+}
+
+func TestGetExifTagValueNoExif(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := GetExifTagValue(nil, "Make")
+	assert.NotNil(err)
+	assert.True(IsNoExifError(err))
+}
+
+func TestGetExifTagValueSubSeconds(t *testing.T) {
+	assert := assert.New(t)
+
+	tags := ExifTags{
+		"DateTimeOriginal":   "2016:08:12 14:30:05",
+		"SubSecTimeOriginal": "07",
+		"DateTime":           "2016:08:12 14:30:05",
+	}
+	value, err := GetExifTagValue(tags, "DateTimeOriginal", "Millisecond")
+	assert.Nil(err)
+	assert.Equal("070", value)
+
+	value, err = GetExifTagValue(tags, "DateTime", "Millisecond")
+	assert.Nil(err)
+	assert.Equal("000", value)
+
+	captureTime, err := GetExifCaptureTime(tags)
+	assert.Nil(err)
+	assert.Equal(70*int(time.Millisecond), captureTime.Nanosecond())
+}
+
+func TestParseSubSeconds(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(500*time.Millisecond, ParseSubSeconds("5"))
+	assert.Equal(123456789*time.Nanosecond, ParseSubSeconds("1234567891"))
+	assert.Equal(time.Duration(0), ParseSubSeconds("  "))
+	assert.Equal(time.Duration(0), ParseSubSeconds("abc"))
+}
+
+func TestReplaceTagsInPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	pattern := `{Model}_{Index scope="{Model}"}_{Model}`
+	replaced := ReplaceTagsInPattern(pattern, []string{"Model", `Index scope="{Model}"`}, []string{"5D", "000001"})
+	assert.Equal("5D_000001_5D", replaced)
+}
+
+func TestExtractFileTagsQuotedBraces(t *testing.T) {
+	assert := assert.New(t)
+
+	tags := ExtractFileOutputTags(`{Make}_{Index scope="{Model}_{DateTimeOriginal.Year}"}.jpg`)
+	assert.Len(tags, 2, fmt.Sprintf("%#v", tags))
+	assert.Equal("Make", tags[0])
+	assert.Equal(`Index scope="{Model}_{DateTimeOriginal.Year}"`, tags[1])
+}
+
+func TestParseTagAttributes(t *testing.T) {
+	assert := assert.New(t)
+
+	tag, attributes, err := ParseTagAttributes(`Index scope="{Model} {Make}" pad=4`)
+	assert.Nil(err)
+	assert.Equal("Index", tag)
+	assert.Equal("{Model} {Make}", attributes["scope"])
+	assert.Equal("4", attributes["pad"])
+
+	tag, attributes, err = ParseTagAttributes("DateTime.Year")
+	assert.Nil(err)
+	assert.Equal("DateTime.Year", tag)
+	assert.Nil(attributes)
+
+	_, _, err = ParseTagAttributes(`Index scope="{Model}`)
+	assert.NotNil(err)
+}
+
+func TestSplitOutsideQuotes(t *testing.T) {
+	assert := assert.New(t)
+
+	parts := SplitOutsideQuotes(`Index scope="{Make|Model}"|File.Index`, '|')
+	assert.Len(parts, 2)
+	assert.Equal(`Index scope="{Make|Model}"`, parts[0])
+	assert.Equal("File.Index", parts[1])
+}
+
+func TestDestinationPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("{Make}.jpg", DestinationPattern("", "{Make}.jpg"))
+	assert.Equal("/mnt/nas/{Make}.jpg", DestinationPattern("/mnt/nas/", "{Make}.jpg"))
+	assert.Equal("/library/{Make}.jpg", DestinationPattern("/mnt/nas", "/library/{Make}.jpg"))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// exifHeaderLimit is the number of bytes read from a jpeg when decoding exif;
+	// the APP1 segment is at most 64KiB and sits at the start of the file.
+	exifHeaderLimit = 256 * 1024
+)
+
+var (
+	jpegMagic = []byte{0xFF, 0xD8}
+)
+
+// FileMetadata is the metadata read from a file ahead of renaming.
+type FileMetadata struct {
+	Path        string
+	Info        os.FileInfo
+	Exif        ExifTags
+	CaptureTime time.Time
+
+	// Hash is the hex encoded sha-256 of the file contents; it is only set
+	// once the file has been hashed.
+	Hash string
+
+	// PerceptualHash is the difference hash of the image; it is only set when
+	// grouping similar images.
+	PerceptualHash *uint64
+	SimilarGroup   *SimilarGroup
+	SimilarIndex   int
+
+	// Sequence is the burst, bracket or panorama sequence the file is part of.
+	Sequence      *Sequence
+	SequenceIndex int
+
+	// Event is the event the file is part of.
+	Event      *Event
+	EventIndex int
+
+	// ScopedIndexes are the indexes assigned to the file, by scope.
+	ScopedIndexes map[string]int
+
+	// ScriptTags are the tags the rename script returned for the file.
+	ScriptTags map[string]string
+
+	// ExtTags are the tags the tag plugin returned for the file, or ExtErr the
+	// reason it didn't.
+	ExtTags map[string]string
+	ExtErr  error
+
+	// Lookups are the rows of the lookup tables that matched the file, by
+	// table name.
+	Lookups map[string]LookupResult
+
+	// Err is set if the exif data or capture time could not be read.
+	Err error
+}
+
+// SetExif sets the exif tags and capture time from the result of decoding.
+func (fm *FileMetadata) SetExif(exifTags ExifTags, err error) {
+	if err != nil {
+		fm.Err = AsFileError(fm.Path, err)
+		return
+	}
+	fm.Exif = exifTags
+	fm.CaptureTime, err = GetExifCaptureTime(exifTags)
+	if err != nil {
+		fm.Err = AsFileError(fm.Path, err)
+	}
+}
+
+// ReadFileMetadata reads the file info, exif data and capture time for a file.
+// If a cache is provided and holds a current entry for the file, the file is
+// not opened.
+func ReadFileMetadata(filePath string, cache *MetadataCache) *FileMetadata {
+	meta := &FileMetadata{Path: filePath}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		meta.Err = NewFileError(ErrorKindIO, filePath, "", err)
+		return meta
+	}
+	meta.Info = info
+
+	if cache == nil {
+		meta.SetExif(ReadExifTags(filePath))
+		return meta
+	}
+
+	key, err := NewMetadataCacheKey(filePath, info, cache.WithHash)
+	if err != nil {
+		meta.Err = NewFileError(ErrorKindIO, filePath, "", err)
+		return meta
+	}
+	meta.Hash = key.Hash
+	if entry, hasEntry := cache.Get(filePath, key); hasEntry {
+		meta.SetExif(entry.Exif, entry.Err(filePath))
+		return meta
+	}
+
+	exifTags, err := ReadExifTags(filePath)
+	if !IsIOError(err) {
+		cache.Put(filePath, key, exifTags, err)
+	}
+	meta.SetExif(exifTags, err)
+	return meta
+}
+
+// ReadExifTags reads the exif tags for a file, only reading the header of jpegs.
+func ReadExifTags(filePath string) (ExifTags, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, NewFileError(ErrorKindIO, filePath, "", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var header io.Reader = reader
+	if magic, err := reader.Peek(len(jpegMagic)); err == nil && bytes.Equal(magic, jpegMagic) {
+		header = io.LimitReader(reader, exifHeaderLimit)
+	}
+
+	exifData, err := DecodeExif(header)
+	if err != nil {
+		return nil, AsFileError(filePath, err)
+	}
+	return NewExifTags(exifData), nil
+}
+
+// ExtractMetadata reads metadata for the files with a given number of workers.
+// The results are in the same order as the files regardless of scheduling.
+func ExtractMetadata(files []string, jobs int, cache *MetadataCache) []*FileMetadata {
+	results := make([]*FileMetadata, len(files))
+	ForEachParallel(len(files), jobs, func(index int) {
+		results[index] = ReadFileMetadata(files[index], cache)
+	})
+	return results
+}
+
+// ForEachParallel calls an action for each index in [0, count) with a given
+// number of workers, returning once every action has completed.
+func ForEachParallel(count, jobs int, action func(index int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	work := make(chan int)
+	wg := sync.WaitGroup{}
+	wg.Add(jobs)
+	for worker := 0; worker < jobs; worker++ {
+		go func() {
+			defer wg.Done()
+			for index := range work {
+				action(index)
+			}
+		}()
+	}
+
+	for index := 0; index < count; index++ {
+		work <- index
+	}
+	close(work)
+	wg.Wait()
+}
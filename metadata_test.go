@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestExtractMetadataOrdered(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(tempDir)
+
+	var files []string
+	for index := 0; index < 32; index++ {
+		file := filepath.Join(tempDir, strconv.Itoa(index)+".jpg")
+		assert.Nil(ioutil.WriteFile(file, []byte{0xFF, 0xD8, 0xFF, 0xD9}, 0644))
+		files = append(files, file)
+	}
+	files = append(files, filepath.Join(tempDir, "missing.jpg"))
+
+	results := ExtractMetadata(files, 4, nil)
+	assert.Len(results, len(files))
+	for index, meta := range results[:32] {
+		assert.Equal(files[index], meta.Path)
+		assert.NotNil(meta.Info)
+		assert.True(IsNoExifError(meta.Err))
+	}
+
+	missing := results[32]
+	assert.Nil(missing.Info)
+	assert.True(IsIOError(missing.Err))
+}
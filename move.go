@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// MoveFile renames a file, creating the target's directory if needed. If the
+// target is on another device, the file is copied, synced and verified
+// against the source's hash before the source is deleted.
+func MoveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(from, to)
+	if err == nil || !isCrossDeviceError(err) {
+		return err
+	}
+	return moveAcrossDevices(from, to)
+}
+
+// moveAcrossDevices copies a file to a temporary name next to its target,
+// preserving its mode, modification time and extended attributes, then
+// renames the copy into place once its contents match the source. The source
+// is only deleted once the rename has been synced to disk.
+func moveAcrossDevices(from, to string) error {
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+
+	tempPath := moveCopyPath(to)
+	sourceHash, err := copyFileSynced(from, tempPath, info.Mode().Perm())
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err = copyExtendedAttributes(from, tempPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err = os.Chtimes(tempPath, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	targetHash, err := HashFile(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if targetHash != sourceHash {
+		os.Remove(tempPath)
+		return fmt.Errorf("move: copy of %s to %s does not match the source", from, to)
+	}
+	if err = os.Rename(tempPath, to); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err = syncDirectory(filepath.Dir(to)); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// moveCopyPath returns the temporary name a file moved across devices is
+// copied to before it is renamed into place.
+func moveCopyPath(to string) string {
+	return filepath.Join(filepath.Dir(to), fmt.Sprintf(".%s.copy", filepath.Base(to)))
+}
+
+// copyFileSynced copies a file and syncs the copy to disk, returning the
+// sha-256 of the source contents.
+func copyFileSynced(from, to string, mode os.FileMode) (string, error) {
+	source, err := os.Open(from)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(to, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(target, io.TeeReader(source, hash)); err != nil {
+		target.Close()
+		return "", err
+	}
+	if err = target.Sync(); err != nil {
+		target.Close()
+		return "", err
+	}
+	if err = target.Close(); err != nil {
+		return "", err
+	}
+	// the umask may have narrowed the mode the file was created with.
+	if err = os.Chmod(to, mode); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
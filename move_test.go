@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestMoveFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "a.jpg")
+	assert.Nil(ioutil.WriteFile(source, []byte("a"), 0644))
+	target := filepath.Join(dir, "2016", "08", "a.jpg")
+	assert.Nil(MoveFile(source, target))
+
+	contents, err := ioutil.ReadFile(target)
+	assert.Nil(err)
+	assert.Equal("a", string(contents))
+	_, err = os.Stat(source)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestMoveAcrossDevices(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "a.jpg")
+	assert.Nil(ioutil.WriteFile(source, []byte("contents"), 0600))
+	modTime := time.Date(2016, 8, 12, 14, 0, 0, 0, time.UTC)
+	assert.Nil(os.Chtimes(source, modTime, modTime))
+	sourceHash, err := HashFile(source)
+	assert.Nil(err)
+
+	target := filepath.Join(dir, "b.jpg")
+	assert.Nil(moveAcrossDevices(source, target))
+
+	info, err := os.Stat(target)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	assert.True(info.ModTime().Equal(modTime))
+	targetHash, err := HashFile(target)
+	assert.Nil(err)
+	assert.Equal(sourceHash, targetHash)
+
+	_, err = os.Stat(source)
+	assert.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, ".b.jpg.copy"))
+	assert.True(os.IsNotExist(err))
+	assert.Nil(syncDirectory(dir))
+}
+
+func TestMoveAcrossDevicesMissingSource(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	assert.NotNil(moveAcrossDevices(filepath.Join(dir, "missing.jpg"), filepath.Join(dir, "b.jpg")))
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(err)
+	assert.Empty(files)
+}
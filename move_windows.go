@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned when a file is moved
+// to another volume.
+const errorNotSameDevice = syscall.Errno(17)
+
+// isCrossDeviceError returns if a rename failed because the target is on
+// another volume.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// syncDirectory does nothing on windows, where directories can't be synced
+// and renames are written through by the filesystem.
+func syncDirectory(directory string) error {
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Pattern is a parsed output pattern.
+type Pattern struct {
+	Source string
+	Nodes  []PatternNode
+}
+
+// PatternNode is a part of a pattern; either literal text or a tag.
+type PatternNode struct {
+	// Column is the column the node starts at, counting from 1.
+	Column  int
+	Literal string
+	Tag     *PatternTag
+}
+
+// PatternTag is a tag in a pattern, e.g. `{DateTimeOriginal.Year|File.ModTime.Year}`.
+type PatternTag struct {
+	// Source is the text between the braces.
+	Source       string
+	Alternatives []PatternTagAlternative
+}
+
+// PatternTagAlternative is one of the `|` separated alternatives of a tag.
+type PatternTagAlternative struct {
+	Source     string
+	Name       string
+	Properties []string
+	Attributes map[string]string
+}
+
+// Path returns the name and properties of the alternative joined by dots.
+func (pta PatternTagAlternative) Path() string {
+	return strings.Join(append([]string{pta.Name}, pta.Properties...), ".")
+}
+
+// Tags returns the tags of the pattern in order.
+func (p *Pattern) Tags() []*PatternTag {
+	var tags []*PatternTag
+	for _, node := range p.Nodes {
+		if node.Tag != nil {
+			tags = append(tags, node.Tag)
+		}
+	}
+	return tags
+}
+
+// ParsePattern parses an output pattern. `{{` and `}}` are a literal brace,
+// and braces within quoted tag attributes don't end the tag.
+func ParsePattern(source string) (*Pattern, error) {
+	pattern := &Pattern{Source: source}
+	column := func(offset int) int {
+		return utf8.RuneCountInString(source[:offset]) + 1
+	}
+
+	var literal strings.Builder
+	literalColumn := 1
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			pattern.Nodes = append(pattern.Nodes, PatternNode{Column: literalColumn, Literal: literal.String()})
+			literal.Reset()
+		}
+	}
+	for offset := 0; offset < len(source); {
+		switch {
+		case strings.HasPrefix(source[offset:], "{{"), strings.HasPrefix(source[offset:], "}}"):
+			if literal.Len() == 0 {
+				literalColumn = column(offset)
+			}
+			literal.WriteByte(source[offset])
+			offset += 2
+		case source[offset] == '}':
+			return nil, fmt.Errorf("pattern: unmatched } at column %d; use }} for a literal brace", column(offset))
+		case source[offset] == '{':
+			length, err := lexPatternTag(source[offset:])
+			if err != nil {
+				return nil, fmt.Errorf("pattern: %v", columnError(err, column(offset)))
+			}
+			tag, err := parsePatternTag(source[offset+1 : offset+length-1])
+			if err != nil {
+				return nil, fmt.Errorf("pattern: %v at column %d", err, column(offset))
+			}
+			flushLiteral()
+			pattern.Nodes = append(pattern.Nodes, PatternNode{Column: column(offset), Tag: tag})
+			offset += length
+		default:
+			if literal.Len() == 0 {
+				literalColumn = column(offset)
+			}
+			literal.WriteByte(source[offset])
+			offset++
+		}
+	}
+	flushLiteral()
+	return pattern, nil
+}
+
+// LexPatternTag returns the tag at the start of a source, without its braces,
+// and the length of the tag including its braces.
+func LexPatternTag(source string) (tag string, length int, err error) {
+	if length, err = lexPatternTag(source); err != nil {
+		return "", 0, columnError(err, 1)
+	}
+	return source[1 : length-1], length, nil
+}
+
+// patternLexError is an error at an offset from the start of a tag.
+type patternLexError struct {
+	offset  int
+	message string
+}
+
+func (ple *patternLexError) Error() string {
+	return ple.message
+}
+
+// columnError places a lex error relative to the column its tag starts at.
+func columnError(err error, tagColumn int) error {
+	lexErr, isLexErr := err.(*patternLexError)
+	if !isLexErr {
+		return err
+	}
+	return fmt.Errorf("%s at column %d", lexErr.message, tagColumn+lexErr.offset)
+}
+
+// lexPatternTag returns the length of the tag at the start of a source. A
+// brace within a tag has to be quoted, as in `{Index scope="{Model}"}`.
+func lexPatternTag(source string) (int, error) {
+	var inQuotes bool
+	runeOffset := 1
+	for index := 1; index < len(source); index++ {
+		switch source[index] {
+		case '"':
+			inQuotes = !inQuotes
+		case '{':
+			if !inQuotes {
+				return 0, &patternLexError{offset: runeOffset, message: "unexpected { in tag; quote braces in attributes or use {{ outside tags"}
+			}
+		case '}':
+			if !inQuotes {
+				return index + 1, nil
+			}
+		}
+		if utf8.RuneStart(source[index]) {
+			runeOffset++
+		}
+	}
+	if inQuotes {
+		return 0, &patternLexError{message: "unterminated quote in tag"}
+	}
+	return 0, &patternLexError{message: "unterminated tag"}
+}
+
+// Render returns the pattern with each tag replaced by its value, in order.
+func (p *Pattern) Render(values []string) string {
+	var rendered strings.Builder
+	var index int
+	for _, node := range p.Nodes {
+		if node.Tag == nil {
+			rendered.WriteString(node.Literal)
+			continue
+		}
+		if index < len(values) {
+			rendered.WriteString(values[index])
+		}
+		index++
+	}
+	return rendered.String()
+}
+
+// EscapePatternLiteral escapes the braces in text that is used as literal
+// text in a pattern.
+func EscapePatternLiteral(text string) string {
+	return strings.NewReplacer("{", "{{", "}", "}}").Replace(text)
+}
+
+func parsePatternTag(source string) (*PatternTag, error) {
+	tag := &PatternTag{Source: source}
+	for _, alternative := range SplitOutsideQuotes(source, '|') {
+		tagName, attributes, err := ParseTagAttributes(alternative)
+		if err != nil {
+			return nil, err
+		}
+		if len(tagName) == 0 {
+			return nil, fmt.Errorf("empty tag {%s}", source)
+		}
+		name, properties := ParseTagProperties(tagName)
+		tag.Alternatives = append(tag.Alternatives, PatternTagAlternative{
+			Source:     alternative,
+			Name:       name,
+			Properties: properties,
+			Attributes: attributes,
+		})
+	}
+	return tag, nil
+}
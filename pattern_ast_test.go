@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestParsePattern(t *testing.T) {
+	assert := assert.New(t)
+
+	pattern, err := ParsePattern(`{DateTimeOriginal.Year|File.ModTime.Year}/{Index scope="{Model}"}_é{Make}.jpg`)
+	assert.Nil(err)
+	assert.Len(pattern.Nodes, 6)
+
+	assert.Equal(1, pattern.Nodes[0].Column)
+	assert.Len(pattern.Nodes[0].Tag.Alternatives, 2)
+	assert.Equal("DateTimeOriginal", pattern.Nodes[0].Tag.Alternatives[0].Name)
+	assert.Equal([]string{"Year"}, pattern.Nodes[0].Tag.Alternatives[0].Properties)
+	assert.Equal("File.ModTime.Year", pattern.Nodes[0].Tag.Alternatives[1].Path())
+
+	assert.Equal("/", pattern.Nodes[1].Literal)
+	assert.Equal(43, pattern.Nodes[2].Column)
+	assert.Equal("{Model}", pattern.Nodes[2].Tag.Alternatives[0].Attributes["scope"])
+	assert.Equal("_é", pattern.Nodes[3].Literal)
+	assert.Equal(68, pattern.Nodes[4].Column)
+	assert.Equal(".jpg", pattern.Nodes[5].Literal)
+	assert.Len(pattern.Tags(), 3)
+}
+
+func TestParsePatternErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParsePattern("{Make}_{Model")
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "unterminated tag at column 8"))
+
+	_, err = ParsePattern("{Make}{}")
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "empty tag {} at column 7"))
+
+	_, err = ParsePattern(`{Index scope="{Model}}`)
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "column 1"))
+}
+
+func TestParsePatternEscapes(t *testing.T) {
+	assert := assert.New(t)
+
+	pattern, err := ParsePattern("{{{Make}}}_{{literal}}.jpg")
+	assert.Nil(err)
+	assert.Len(pattern.Nodes, 3)
+	assert.Equal("{", pattern.Nodes[0].Literal)
+	assert.Equal(3, pattern.Nodes[1].Column)
+	assert.Equal("Make", pattern.Nodes[1].Tag.Source)
+	assert.Equal("}_{literal}.jpg", pattern.Nodes[2].Literal)
+	assert.Equal(9, pattern.Nodes[2].Column)
+	assert.Equal("{Canon}_{literal}.jpg", pattern.Render([]string{"Canon"}))
+
+	assert.Equal([]string{"Make"}, ExtractFileOutputTags("{{{Make}}}_{{literal}}.jpg"))
+	assert.Equal("{5D}_{Make}", ReplaceTagsInPattern("{{{Model}}}_{Make}", []string{"Model"}, []string{"5D"}))
+	assert.Equal("{{a}}{{b}}", EscapePatternLiteral("{a}{b}"))
+}
+
+func TestParsePatternLexErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	for source, expected := range map[string]string{
+		"{Make}_}":                    "unmatched } at column 8; use }} for a literal brace",
+		"é{Make{Model}}":              "unexpected { in tag; quote braces in attributes or use {{ outside tags at column 7",
+		`{Make}{Index scope="{Model}`: "unterminated quote in tag at column 7",
+		"{{Make}":                     "unmatched } at column 7; use }} for a literal brace",
+		"{Make}{{{Model":              "unterminated tag at column 9",
+	} {
+		_, err := ParsePattern(source)
+		assert.NotNil(err, source)
+		assert.Equal("pattern: "+expected, err.Error(), source)
+	}
+}
+
+func TestLexPatternTag(t *testing.T) {
+	assert := assert.New(t)
+
+	tag, length, err := LexPatternTag(`{Index scope="{Model}"} == 1`)
+	assert.Nil(err)
+	assert.Equal(`Index scope="{Model}"`, tag)
+	assert.Equal(23, length)
+
+	_, _, err = LexPatternTag("{Make == 1")
+	assert.NotNil(err)
+	assert.Equal("unterminated tag at column 1", err.Error())
+}
+
+func TestExtractFileOutputTagsInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(ExtractFileOutputTags("{Make}_{Model"))
+	assert.Equal("{Make}_{Model", ReplaceTagsInPattern("{Make}_{Model", []string{"Make"}, []string{"Canon"}))
+}
+
+func FuzzParsePattern(f *testing.F) {
+	for _, seed := range []string{
+		DefaultFileOutputPattern,
+		`{Make}_{Index scope="{Model}_{DateTimeOriginal.Year}"}.jpg`,
+		"{{literal}}_{Make|Model}",
+		"{Make", "}", "{}", `{"`, `{Index scope="}`, "{{{", "}}}", "é{Make}",
+		"{File.Hash.Short}/{Event.Start.Year} {Index scope=camera}",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		tags := ExtractFileOutputTags(source)
+		PatternDirectory(source)
+		ReplaceTagsInPattern(source, tags, tags)
+
+		pattern, err := ParsePattern(source)
+		if err != nil {
+			if !strings.Contains(err.Error(), "column") && !strings.Contains(err.Error(), "tag") {
+				t.Fatalf("%q: error without a position: %v", source, err)
+			}
+			return
+		}
+		LintPattern(pattern)
+		if len(tags) != len(pattern.Tags()) {
+			t.Fatalf("%q: %d tags extracted, %d parsed", source, len(tags), len(pattern.Tags()))
+		}
+
+		// escaping the literals and putting the tags back gives the same pattern.
+		var rebuilt strings.Builder
+		for _, node := range pattern.Nodes {
+			if node.Tag != nil {
+				rebuilt.WriteString("{" + node.Tag.Source + "}")
+				continue
+			}
+			rebuilt.WriteString(EscapePatternLiteral(node.Literal))
+		}
+		reparsed, err := ParsePattern(rebuilt.String())
+		if err != nil {
+			t.Fatalf("%q: rebuilt pattern %q doesn't parse: %v", source, rebuilt.String(), err)
+		}
+		if len(reparsed.Nodes) != len(pattern.Nodes) {
+			t.Fatalf("%q: rebuilt pattern %q has %d nodes, not %d", source, rebuilt.String(), len(reparsed.Nodes), len(pattern.Nodes))
+		}
+	})
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// PatternIssue is a problem found in a pattern before any file is renamed.
+// Warnings are logged; anything else stops the run.
+type PatternIssue struct {
+	// Column is the column of the tag the issue is for, or 0 if it is for the
+	// pattern as a whole.
+	Column  int
+	Tag     string
+	Message string
+	Warning bool
+}
+
+// String implements fmt.Stringer.
+func (pi PatternIssue) String() string {
+	message := pi.Message
+	if len(pi.Tag) > 0 {
+		message = fmt.Sprintf("{%s}: %s", pi.Tag, message)
+	}
+	if pi.Column > 0 {
+		message = fmt.Sprintf("column %d: %s", pi.Column, message)
+	}
+	if pi.Warning {
+		return "warning: " + message
+	}
+	return message
+}
+
+// computedNamespaces are the tag names that aren't exif fields.
+var computedNamespaces = []string{"Index", "File", "Group", "Sequence", "Event", "Script", "Ext", "Lookup"}
+
+func isComputedNamespace(name string) bool {
+	for _, namespace := range computedNamespaces {
+		if namespace == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LintPattern checks every tag of a pattern against the exif fields and the
+// computed tags, and warns if the pattern can give two files the same name.
+func LintPattern(pattern *Pattern) []PatternIssue {
+	issues := lintPatternTags(pattern)
+	if !IsUniquePattern(pattern) {
+		issues = append(issues, PatternIssue{
+			Message: "the pattern has no index, hash or file name tag, so files can be given the same name",
+			Warning: true,
+		})
+	}
+	return issues
+}
+
+func lintPatternTags(pattern *Pattern) []PatternIssue {
+	var issues []PatternIssue
+	for _, node := range pattern.Nodes {
+		if node.Tag == nil {
+			continue
+		}
+		for _, alternative := range node.Tag.Alternatives {
+			for _, message := range lintTagAlternative(alternative) {
+				issues = append(issues, PatternIssue{Column: node.Column, Tag: node.Tag.Source, Message: message})
+			}
+		}
+	}
+	return issues
+}
+
+func lintTagAlternative(alternative PatternTagAlternative) []string {
+	if alternative.Name == "Index" {
+		return lintIndexTag(alternative)
+	}
+
+	var messages []string
+	for key := range alternative.Attributes {
+		messages = append(messages, fmt.Sprintf("unknown attribute %q; only Index takes attributes", key))
+	}
+
+	if alternative.Name == "Script" || alternative.Name == "Ext" {
+		if len(alternative.Properties) != 1 {
+			messages = append(messages, fmt.Sprintf("%s tags take a single name, e.g. %s.name", alternative.Name, alternative.Name))
+		}
+		return messages
+	}
+	if alternative.Name == "Lookup" {
+		if len(alternative.Properties) < 2 {
+			messages = append(messages, "lookup tags take a table and a column, e.g. Lookup.schedule.client")
+		}
+		return messages
+	}
+	if isComputedNamespace(alternative.Name) {
+		if message := lintComputedTag(alternative.Path()); len(message) > 0 {
+			messages = append(messages, message)
+		}
+		return messages
+	}
+
+	field := exif.FieldName(alternative.Name)
+	if !isExifFieldName(field) {
+		return append(messages, fmt.Sprintf("unknown tag %q%s", alternative.Name, suggestTagName(alternative.Name, exifTagVocabulary())))
+	}
+	if len(alternative.Properties) == 0 {
+		return messages
+	}
+	if _, isTimestamp := timestampFields[field]; !isTimestamp {
+		return append(messages, fmt.Sprintf("%s is not a date time field and has no properties", alternative.Name))
+	}
+	if message := lintTimestampProperties(alternative.Properties); len(message) > 0 {
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func lintIndexTag(alternative PatternTagAlternative) []string {
+	var messages []string
+	if len(alternative.Properties) > 0 {
+		messages = append(messages, fmt.Sprintf("unknown property %q; Index has no properties", strings.Join(alternative.Properties, ".")))
+	}
+	for key, scope := range alternative.Attributes {
+		if key != "scope" {
+			messages = append(messages, fmt.Sprintf("unknown attribute %q; Index only takes scope", key))
+			continue
+		}
+		switch scope {
+		case IndexScopeCamera, IndexScopeDirectory, IndexScopeHour, IndexScopeWeek, IndexScopeEvent:
+			continue
+		}
+		if !strings.Contains(scope, "{") {
+			messages = append(messages, fmt.Sprintf("unknown index scope %q; must be camera, directory, hour, week, event or a pattern", scope))
+			continue
+		}
+		scopePattern, err := ParsePattern(scope)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("scope: %v", err))
+			continue
+		}
+		for _, issue := range lintPatternTags(scopePattern) {
+			messages = append(messages, fmt.Sprintf("scope: {%s}: %s", issue.Tag, issue.Message))
+		}
+	}
+	return messages
+}
+
+// lintComputedTag checks a computed tag path against ComputedTags.
+func lintComputedTag(path string) string {
+	for _, tag := range ComputedTags {
+		if path == tag.Name {
+			return ""
+		}
+		if tag.Timestamp && strings.HasPrefix(path, tag.Name+".") {
+			return lintTimestampProperties(strings.Split(strings.TrimPrefix(path, tag.Name+"."), "."))
+		}
+	}
+	return fmt.Sprintf("unknown tag %q%s", path, suggestTagName(path, computedTagVocabulary()))
+}
+
+func lintTimestampProperties(properties []string) string {
+	if len(properties) > 1 {
+		return fmt.Sprintf("unknown property %q; date times take a single property", strings.Join(properties, "."))
+	}
+	for _, property := range TimestampProperties {
+		if property == properties[0] {
+			return ""
+		}
+	}
+	return fmt.Sprintf("unknown date time property %q%s", properties[0], suggestTagName(properties[0], TimestampProperties))
+}
+
+// IsUniquePattern returns if a pattern has a tag that differs for every file;
+// an index, the file hash or the original file name. A tag with alternatives
+// only counts if each of them does.
+func IsUniquePattern(pattern *Pattern) bool {
+	for _, tag := range pattern.Tags() {
+		unique := true
+		for _, alternative := range tag.Alternatives {
+			unique = unique && isUniqueTag(alternative)
+		}
+		if unique {
+			return true
+		}
+	}
+	return false
+}
+
+func isUniqueTag(alternative PatternTagAlternative) bool {
+	switch alternative.Path() {
+	case "Index", "File.Index", "File.IndexByCaptureYear", "File.IndexByCaptureMonth", "File.IndexByCaptureDate",
+		"File.Hash", "File.Hash.Short", "File.Name":
+		return true
+	}
+	return false
+}
+
+// the ifd pointers aren't listed in ExifFieldNames but are still read.
+var exifPointerFieldNames = []exif.FieldName{exif.ExifIFDPointer, exif.GPSInfoIFDPointer, exif.InteroperabilityIFDPointer}
+
+func isExifFieldName(field exif.FieldName) bool {
+	for _, name := range ExifFieldNames {
+		if name == field {
+			return true
+		}
+	}
+	for _, name := range exifPointerFieldNames {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+func exifTagVocabulary() []string {
+	names := make([]string, 0, len(ExifFieldNames)+len(computedNamespaces))
+	for _, field := range ExifFieldNames {
+		names = append(names, string(field))
+	}
+	return append(names, computedNamespaces...)
+}
+
+func computedTagVocabulary() []string {
+	names := make([]string, 0, len(ComputedTags))
+	for _, tag := range ComputedTags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// suggestTagName returns a `; did you mean X?` suffix for the closest known
+// name, if any is close enough to be a typo.
+func suggestTagName(name string, known []string) string {
+	var best string
+	bestDistance := len(name)/3 + 2
+	for _, candidate := range known {
+		if distance := editDistance(strings.ToLower(name), strings.ToLower(candidate)); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if len(best) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("; did you mean %s?", best)
+}
+
+// editDistance is the levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func lintPatternSource(t *testing.T, source string) []PatternIssue {
+	pattern, err := ParsePattern(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return LintPattern(pattern)
+}
+
+func TestLintPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(lintPatternSource(t, DefaultFileOutputPattern))
+	assert.Empty(lintPatternSource(t, "{File.ModTime.Year}/{Event.Index.Within}_{Sequence.Kind}_{Group.Series}_{File.Hash.Short}"))
+	assert.Empty(lintPatternSource(t, `{Event.Start.WeekYear}-{Index scope="{Make}_{DateTimeOriginal.Month}"}`))
+	assert.Empty(lintPatternSource(t, "{Index scope=camera}_{GPSLatitude}"))
+
+	issues := lintPatternSource(t, "{Index}_{DateTimeDigitzed.Year}")
+	assert.Len(issues, 1)
+	assert.Equal(9, issues[0].Column)
+	assert.False(issues[0].Warning)
+	assert.Equal(`column 9: {DateTimeDigitzed.Year}: unknown tag "DateTimeDigitzed"; did you mean DateTimeDigitized?`, issues[0].String())
+
+	issues = lintPatternSource(t, "{Index}{File.Extention}{File}{Event.Index.Without}")
+	assert.Len(issues, 3)
+	assert.True(strings.Contains(issues[0].Message, "did you mean File.Extension?"))
+	assert.Equal(`unknown tag "File"`, issues[1].Message)
+	assert.Equal(`unknown tag "Event.Index.Without"; did you mean Event.Index.Within?`, issues[2].Message)
+}
+
+func TestLintPatternProperties(t *testing.T) {
+	assert := assert.New(t)
+
+	issues := lintPatternSource(t, "{Index}{DateTime.Yaer}{File.ModTime.Year.Day}{Model.Year}{Index.Year}")
+	assert.Len(issues, 4)
+	assert.Equal(`unknown date time property "Yaer"; did you mean Year?`, issues[0].Message)
+	assert.True(strings.Contains(issues[1].Message, "single property"))
+	assert.True(strings.Contains(issues[2].Message, "not a date time field"))
+	assert.True(strings.Contains(issues[3].Message, "Index has no properties"))
+}
+
+func TestLintPatternExternalTags(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(lintPatternSource(t, "{Index}_{Script.client}_{Ext.assetId}_{Lookup.schedule.client}_{Lookup.bodies.owner.email}"))
+
+	issues := lintPatternSource(t, "{Index}{Script}{Ext.asset.id}{Lookup.schedule}")
+	assert.Len(issues, 3)
+	assert.Equal("Script tags take a single name, e.g. Script.name", issues[0].Message)
+	assert.Equal("Ext tags take a single name, e.g. Ext.name", issues[1].Message)
+	assert.Equal("lookup tags take a table and a column, e.g. Lookup.schedule.client", issues[2].Message)
+}
+
+func TestLintPatternAttributes(t *testing.T) {
+	assert := assert.New(t)
+
+	issues := lintPatternSource(t, `{Index scope=month}{Index scope="{Modle}"}{Make scope=camera}`)
+	assert.Len(issues, 3)
+	assert.True(strings.Contains(issues[0].Message, `unknown index scope "month"`))
+	assert.True(strings.Contains(issues[1].Message, `scope: {Modle}: unknown tag "Modle"; did you mean Model?`))
+	assert.True(strings.Contains(issues[2].Message, "only Index takes attributes"))
+}
+
+func TestLintPatternUniqueness(t *testing.T) {
+	assert := assert.New(t)
+
+	issues := lintPatternSource(t, "{DateTimeOriginal.Year}_{Model}")
+	assert.Len(issues, 1)
+	assert.True(issues[0].Warning)
+	assert.Equal(0, issues[0].Column)
+
+	assert.Empty(lintPatternSource(t, "{DateTimeOriginal.Year}_{File.Hash.Short}"))
+	assert.Empty(lintPatternSource(t, "{File.IndexByCaptureDate|File.Name}"))
+	assert.Len(lintPatternSource(t, "{File.Index|Model}"), 1)
+}
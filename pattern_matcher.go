@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// PatternMatcher matches file names against an output pattern, extracting the
+// value of each tag.
+type PatternMatcher struct {
+	Pattern string
+	Tags    []string
+	regex   *regexp.Regexp
+}
+
+// NewPatternMatcher returns a new pattern matcher for an output pattern.
+// Tags with a known format, like indexes and date properties, only match that
+// format so adjacent tags split unambiguously; other tags match as little as
+// they can within a single path segment.
+func NewPatternMatcher(pattern string) (*PatternMatcher, error) {
+	tags := ExtractFileOutputTags(pattern)
+	values := make([]string, len(tags))
+	for index, tag := range tags {
+		values[index] = "(" + TagExpression(tag) + ")"
+	}
+
+	// quote the literal text between the tags, leaving the groups as is.
+	placeholders := make([]string, len(tags))
+	for index := range tags {
+		placeholders[index] = "\x00"
+	}
+	literals := strings.Split(ReplaceTagsInPattern(strings.TrimPrefix(pattern, "./"), tags, placeholders), "\x00")
+
+	var expression strings.Builder
+	expression.WriteString("^")
+	for index, literal := range literals {
+		expression.WriteString(regexp.QuoteMeta(filepath.ToSlash(literal)))
+		if index < len(tags) {
+			expression.WriteString(values[index])
+		}
+	}
+	expression.WriteString("$")
+
+	regex, err := regexp.Compile(expression.String())
+	if err != nil {
+		return nil, err
+	}
+	return &PatternMatcher{Pattern: pattern, Tags: tags, regex: regex}, nil
+}
+
+// Match returns the value of each tag if a file name matches the pattern.
+// If a tag appears more than once, the first value is returned.
+func (pm *PatternMatcher) Match(name string) (map[string]string, bool) {
+	groups := pm.regex.FindStringSubmatch(strings.TrimPrefix(filepath.ToSlash(name), "./"))
+	if groups == nil {
+		return nil, false
+	}
+	values := map[string]string{}
+	for index, tag := range pm.Tags {
+		if _, hasTag := values[tag]; !hasTag {
+			values[tag] = groups[index+1]
+		}
+	}
+	return values, true
+}
+
+// MatchPath matches the path a file would have been renamed to; relative
+// patterns are matched against the path relative to the current directory.
+func (pm *PatternMatcher) MatchPath(filePath string) (map[string]string, bool) {
+	absolutePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, false
+	}
+	if filepath.IsAbs(pm.Pattern) || strings.HasPrefix(pm.Pattern, "/") {
+		return pm.Match(absolutePath)
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, false
+	}
+	relativePath, err := filepath.Rel(workingDir, absolutePath)
+	if err != nil {
+		return nil, false
+	}
+	return pm.Match(relativePath)
+}
+
+// TagExpression returns the regular expression that matches the values of a
+// tag.
+func TagExpression(tag string) string {
+	if IsIndexTag(tag) {
+		return `\d+`
+	}
+	if len(SplitOutsideQuotes(tag, '|')) > 1 {
+		return anyValueExpression
+	}
+	tagName, _, err := ParseTagAttributes(tag)
+	if err != nil {
+		return anyValueExpression
+	}
+
+	namespace, properties := ParseTagProperties(tagName)
+	var property string
+	if len(properties) > 0 {
+		property = properties[0]
+	}
+	switch namespace {
+	case "File":
+		switch property {
+		case "Extension":
+			return `[^./]+`
+		case "Size":
+			return `\d+`
+		case "Hash":
+			if len(properties) > 1 && properties[1] == "Short" {
+				return fmt.Sprintf("[0-9a-f]{%d}", shortHashLength)
+			}
+			return `[0-9a-f]{64}`
+		case "ModTime":
+			return timestampExpression(properties[1:]...)
+		}
+	case "Group", "Sequence":
+		switch property {
+		case "Id", "Index", "Size":
+			return `\d+`
+		case "Kind":
+			return strings.Join([]string{string(SequenceKindSingle), string(SequenceKindBurst), string(SequenceKindBracket), string(SequenceKindPanorama)}, "|")
+		case "Series":
+			return `(?:-\d+)?`
+		}
+	case "Event":
+		switch property {
+		case "Index", "Size":
+			return `\d+`
+		case "Start", "End":
+			return timestampExpression(properties[1:]...)
+		}
+	default:
+		if _, isTimestampField := timestampFields[exif.FieldName(namespace)]; isTimestampField {
+			return timestampExpression(properties...)
+		}
+	}
+	return anyValueExpression
+}
+
+// anyValueExpression matches as little as it can within a path segment.
+const anyValueExpression = `[^/]+?`
+
+// timestampExpression returns the regular expression for a timestamp property.
+func timestampExpression(properties ...string) string {
+	if len(properties) == 0 {
+		return anyValueExpression
+	}
+	switch properties[0] {
+	case "Year", "WeekYear":
+		return `\d{4}`
+	case "Month", "Day", "Hour", "Minute", "Second", "Week":
+		return `\d{2}`
+	case "Millisecond":
+		return `\d{3}`
+	case "Microsecond":
+		return `\d{6}`
+	case "Nanosecond":
+		return `\d+`
+	case "Unix":
+		return `-?\d+`
+	case "Weekday":
+		return `[A-Za-z]+`
+	}
+	return anyValueExpression
+}
+
+// IsIndexTag returns if a tag is one of the index tags.
+func IsIndexTag(tag string) bool {
+	tagName, _, err := ParseTagAttributes(tag)
+	if err != nil {
+		return false
+	}
+	switch tagName {
+	case "Index", "File.Index", "File.IndexByCaptureYear", "File.IndexByCaptureMonth", "File.IndexByCaptureDate":
+		return true
+	}
+	return false
+}
+
+// PatternDirectory returns the leading directory of an output pattern that
+// does not contain any tags.
+func PatternDirectory(source string) string {
+	var pattern string
+	if parsed, err := ParsePattern(source); err == nil && len(parsed.Nodes) > 0 {
+		pattern = parsed.Nodes[0].Literal
+	}
+	lastSeparator := strings.LastIndexAny(pattern, `/`+string(filepath.Separator))
+	if lastSeparator < 0 {
+		return "."
+	}
+	if lastSeparator == 0 {
+		return pattern[:1]
+	}
+	return pattern[:lastSeparator]
+}
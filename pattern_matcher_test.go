@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestPatternMatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	matcher, err := NewPatternMatcher("{DateTimeOriginal.Year}{DateTimeOriginal.Month}{DateTimeOriginal.Day}_{Make}_{File.IndexByCaptureDate}.{File.Extension}")
+	assert.Nil(err)
+
+	values, matches := matcher.Match("20160812_Canon_000140.jpg")
+	assert.True(matches)
+	assert.Equal("Canon", values["Make"])
+	assert.Equal("000140", values["File.IndexByCaptureDate"])
+	assert.Equal("jpg", values["File.Extension"])
+
+	_, matches = matcher.Match("20160812_Canon_final.jpg")
+	assert.False(matches)
+	_, matches = matcher.Match("IMG_0001.jpg")
+	assert.False(matches)
+}
+
+func TestPatternMatcherLiterals(t *testing.T) {
+	assert := assert.New(t)
+
+	matcher, err := NewPatternMatcher(`library/{Model} (copy)+{Index scope="{Model}"}.jpg`)
+	assert.Nil(err)
+
+	values, matches := matcher.Match("library/5D (copy)+0007.jpg")
+	assert.True(matches)
+	assert.Equal("5D", values["Model"])
+	assert.Equal("0007", values[`Index scope="{Model}"`])
+
+	_, matches = matcher.Match("library/5D copy+0007.jpg")
+	assert.False(matches)
+}
+
+func TestPatternDirectory(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(".", PatternDirectory("{Make}_{File.Index}.jpg"))
+	assert.Equal("library", PatternDirectory("library/{Make}_{File.Index}.jpg"))
+	assert.Equal("library", PatternDirectory("library/{DateTimeOriginal.Year}/{File.Index}.jpg"))
+	assert.Equal("/", PatternDirectory("/{File.Index}.jpg"))
+}
+
+func TestPatternMatcherTypedTags(t *testing.T) {
+	assert := assert.New(t)
+
+	matcher, err := NewPatternMatcher("{DateTimeOriginal.Year}{DateTimeOriginal.Month}{DateTimeOriginal.Day}{DateTimeOriginal.Hour}{Make}{Sequence.Kind}{File.Hash.Short}.{File.Extension}")
+	assert.Nil(err)
+
+	values, matches := matcher.Match("2016081214Canonburst0123abcd.tar.jpg")
+	assert.False(matches)
+
+	values, matches = matcher.Match("2016081214Canonburst0123abcd.jpg")
+	assert.True(matches)
+	assert.Equal("2016", values["DateTimeOriginal.Year"])
+	assert.Equal("08", values["DateTimeOriginal.Month"])
+	assert.Equal("12", values["DateTimeOriginal.Day"])
+	assert.Equal("14", values["DateTimeOriginal.Hour"])
+	assert.Equal("Canon", values["Make"])
+	assert.Equal("burst", values["Sequence.Kind"])
+	assert.Equal("0123abcd", values["File.Hash.Short"])
+}
+
+func TestPatternMatcherPath(t *testing.T) {
+	assert := assert.New(t)
+
+	matcher, err := NewPatternMatcher("./{Make}/{File.Index}.jpg")
+	assert.Nil(err)
+
+	values, matches := matcher.MatchPath("Canon/000001.jpg")
+	assert.True(matches)
+	assert.Equal("Canon", values["Make"])
+	_, matches = matcher.Match("./Canon/000001.jpg")
+	assert.True(matches)
+	_, matches = matcher.Match("Canon/2016/000001.jpg")
+	assert.False(matches)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+	"os"
+	"strings"
+
+	// register the jpeg decoder for image.Decode.
+	_ "image/jpeg"
+)
+
+const (
+	// DefaultSimilarThreshold is the default maximum number of differing bits
+	// between the perceptual hashes of two similar images.
+	DefaultSimilarThreshold = 10
+
+	differenceHashWidth  = 9
+	differenceHashHeight = 8
+)
+
+// DifferenceHash returns the 64 bit difference hash (dHash) of an image.
+// The image is reduced to a 9x8 grayscale grid and each bit records if a cell
+// is brighter than its right neighbor, so re-encoding and resizing an image
+// changes few, if any, bits.
+func DifferenceHash(img image.Image) uint64 {
+	gray := downscaleGray(img, differenceHashWidth, differenceHashHeight)
+
+	var hash uint64
+	for y := 0; y < differenceHashHeight; y++ {
+		for x := 0; x < differenceHashWidth-1; x++ {
+			hash <<= 1
+			if gray[y*differenceHashWidth+x] > gray[y*differenceHashWidth+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// downscaleGray returns the average luminance of each cell of a width by
+// height grid laid over the image.
+func downscaleGray(img image.Image, width, height int) []uint64 {
+	bounds := img.Bounds()
+	cells := make([]uint64, width*height)
+	counts := make([]uint64, width*height)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cellY := (y - bounds.Min.Y) * height / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cellX := (x - bounds.Min.X) * width / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			cell := cellY*width + cellX
+			cells[cell] += (299*uint64(r) + 587*uint64(g) + 114*uint64(b)) / 1000
+			counts[cell]++
+		}
+	}
+	for cell := range cells {
+		if counts[cell] > 0 {
+			cells[cell] /= counts[cell]
+		}
+	}
+	return cells
+}
+
+// HammingDistance returns the number of differing bits between two hashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// ReadPerceptualHash returns the difference hash for an image file, using the
+// exif jpeg thumbnail if there is one and decoding the full image otherwise.
+func ReadPerceptualHash(filePath string) (uint64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, NewFileError(ErrorKindIO, filePath, "", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(len(jpegMagic)); err == nil && bytes.Equal(magic, jpegMagic) {
+		if exifData, err := DecodeExif(io.LimitReader(reader, exifHeaderLimit)); err == nil {
+			if thumbnail, err := exifData.JpegThumbnail(); err == nil {
+				if img, _, err := image.Decode(bytes.NewReader(thumbnail)); err == nil {
+					return DifferenceHash(img), nil
+				}
+			}
+		}
+		// the exif decode consumed part of the reader, so start over for the full image.
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return 0, NewFileError(ErrorKindIO, filePath, "", err)
+		}
+		reader.Reset(file)
+	}
+
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		return 0, NewFileError(ErrorKindIO, filePath, "", fmt.Errorf("perceptual hash: %v", err))
+	}
+	return DifferenceHash(img), nil
+}
+
+// ComputePerceptualHashes sets the perceptual hash for each file with a given
+// number of workers. Files that cannot be hashed are left in their own group.
+func ComputePerceptualHashes(metas []*FileMetadata, jobs int, cache *MetadataCache) {
+	ForEachParallel(len(metas), jobs, func(index int) {
+		meta := metas[index]
+		if meta.Info == nil {
+			return
+		}
+		if cache != nil {
+			if hash, hasHash := cache.PerceptualHash(meta.Path); hasHash {
+				meta.PerceptualHash = &hash
+				return
+			}
+		}
+		hash, err := ReadPerceptualHash(meta.Path)
+		if err != nil {
+			return
+		}
+		meta.PerceptualHash = &hash
+		if cache != nil {
+			cache.PutPerceptualHash(meta.Path, hash)
+		}
+	})
+}
+
+// SimilarGroup is a set of visually similar files, in file order.
+type SimilarGroup struct {
+	ID    int
+	Files []*FileMetadata
+}
+
+// GroupSimilar groups files whose perceptual hashes differ by at most the
+// threshold number of bits; similarity is transitive, so a slow pan of
+// bursts ends up in one group. Every file is assigned a group, and groups are
+// numbered in order of their first file.
+func GroupSimilar(metas []*FileMetadata, threshold int) []*SimilarGroup {
+	parents := make([]int, len(metas))
+	for index := range parents {
+		parents[index] = index
+	}
+	var find func(int) int
+	find = func(index int) int {
+		if parents[index] != index {
+			parents[index] = find(parents[index])
+		}
+		return parents[index]
+	}
+
+	for i := range metas {
+		if metas[i].PerceptualHash == nil {
+			continue
+		}
+		for j := i + 1; j < len(metas); j++ {
+			if metas[j].PerceptualHash == nil {
+				continue
+			}
+			if HammingDistance(*metas[i].PerceptualHash, *metas[j].PerceptualHash) <= threshold {
+				rootI, rootJ := find(i), find(j)
+				if rootI < rootJ {
+					parents[rootJ] = rootI
+				} else {
+					parents[rootI] = rootJ
+				}
+			}
+		}
+	}
+
+	byRoot := map[int]*SimilarGroup{}
+	var groups []*SimilarGroup
+	for index, meta := range metas {
+		root := find(index)
+		group, hasGroup := byRoot[root]
+		if !hasGroup {
+			group = &SimilarGroup{ID: len(groups) + 1}
+			byRoot[root] = group
+			groups = append(groups, group)
+		}
+		group.Files = append(group.Files, meta)
+		meta.SimilarGroup = group
+		meta.SimilarIndex = len(group.Files)
+	}
+	return groups
+}
+
+// GetGroupTagValue gets a `Group.*` tag value.
+func GetGroupTagValue(meta *FileMetadata, tag string, properties ...string) (string, error) {
+	if meta.SimilarGroup == nil {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("similar image grouping is disabled; use --similar"))
+	}
+	if len(properties) > 0 {
+		switch properties[0] {
+		case "Id":
+			return fmt.Sprintf("%06d", meta.SimilarGroup.ID), nil
+		case "Index":
+			return fmt.Sprintf("%02d", meta.SimilarIndex), nil
+		case "Size":
+			return fmt.Sprintf("%d", len(meta.SimilarGroup.Files)), nil
+		case "Series":
+			if len(meta.SimilarGroup.Files) > 1 {
+				return fmt.Sprintf("-%02d", meta.SimilarIndex), nil
+			}
+			return "", nil
+		}
+	}
+	return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("unknown property %q", strings.Join(properties, ".")))
+}
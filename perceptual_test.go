@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func gradientImage(width, height int, inverted bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+			value := uint8(127 + 100*math.Sin(fx*3*math.Pi+fy*2*math.Pi))
+			if inverted {
+				value = 255 - value
+			}
+			img.SetGray(x, y, color.Gray{Y: value})
+		}
+	}
+	return img
+}
+
+func TestDifferenceHash(t *testing.T) {
+	assert := assert.New(t)
+
+	small := DifferenceHash(gradientImage(90, 80, false))
+	large := DifferenceHash(gradientImage(900, 800, false))
+	inverted := DifferenceHash(gradientImage(90, 80, true))
+
+	assert.True(HammingDistance(small, large) <= 2)
+	assert.True(HammingDistance(small, inverted) > DefaultSimilarThreshold)
+}
+
+func TestGroupSimilar(t *testing.T) {
+	assert := assert.New(t)
+
+	hashes := []uint64{0xFF00, 0xFF01, 0x00FF00FF00FF00FF, 0xFF03}
+	var metas []*FileMetadata
+	for index := range hashes {
+		metas = append(metas, &FileMetadata{PerceptualHash: &hashes[index]})
+	}
+	metas = append(metas, &FileMetadata{})
+
+	groups := GroupSimilar(metas, 2)
+	assert.Len(groups, 3)
+	assert.Len(groups[0].Files, 3)
+	assert.Equal(1, metas[0].SimilarGroup.ID)
+	assert.Equal(2, metas[2].SimilarGroup.ID)
+	assert.Equal(3, metas[4].SimilarGroup.ID)
+
+	value, err := GetGroupTagValue(metas[3], "Group", "Index")
+	assert.Nil(err)
+	assert.Equal("03", value)
+
+	value, err = GetGroupTagValue(metas[3], "Group", "Series")
+	assert.Nil(err)
+	assert.Equal("-03", value)
+
+	value, err = GetGroupTagValue(metas[2], "Group", "Series")
+	assert.Nil(err)
+	assert.Equal("", value)
+
+	_, err = GetGroupTagValue(&FileMetadata{}, "Group", "Id")
+	assert.True(IsMissingTagError(err))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultPluginTimeout is how long a tag plugin has to answer each file.
+const DefaultPluginTimeout = 10 * time.Second
+
+// PluginRecord is the json line written to a tag plugin for each file.
+type PluginRecord struct {
+	ID   int               `json:"id"`
+	Path string            `json:"path"`
+	Tags map[string]string `json:"tags"`
+}
+
+// PluginResponse is the json line a tag plugin answers a record with; the
+// tags are used as `{Ext.name}`. Responses can come in any order.
+type PluginResponse struct {
+	ID    int               `json:"id"`
+	Tags  map[string]string `json:"tags"`
+	Error string            `json:"error,omitempty"`
+}
+
+// NewTagPlugin returns a tag plugin for a command line; the executable and
+// its arguments are separated by spaces, and double quotes keep an argument
+// or a path with spaces together.
+func NewTagPlugin(commandLine string, timeout time.Duration) (*TagPlugin, error) {
+	if strings.Count(commandLine, `"`)%2 != 0 {
+		return nil, fmt.Errorf("plugin: unterminated quote in %q", commandLine)
+	}
+	var fields []string
+	for _, part := range SplitOutsideQuotes(strings.TrimSpace(commandLine), ' ') {
+		// repeated spaces leave empty parts; "" is an empty argument.
+		if len(part) > 0 {
+			fields = append(fields, strings.Replace(part, `"`, "", -1))
+		}
+	}
+	if len(fields) == 0 || len(fields[0]) == 0 {
+		return nil, fmt.Errorf("plugin: empty command")
+	}
+	return &TagPlugin{Command: fields[0], Args: fields[1:], Timeout: timeout}, nil
+}
+
+// TagPlugin is an executable that provides extra tags for files. It is started
+// once per run, is written a PluginRecord json line per file on stdin, and
+// writes a PluginResponse json line per file on stdout; anything it writes
+// to stderr is passed through.
+//
+// A plugin that fails for a file, answers with invalid json, stops answering
+// for longer than the timeout or exits early only fails the files it didn't
+// answer; their `Ext` tags are missing.
+type TagPlugin struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+// Provide runs the plugin for files, setting their `Ext` tags or the error
+// the plugin failed them with. The returned error is only set if the plugin
+// couldn't be started.
+func (tp *TagPlugin) Provide(metas []*FileMetadata) error {
+	if len(metas) == 0 {
+		return nil
+	}
+	cmd := exec.Command(tp.Command, tp.Args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("plugin: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("plugin: %v", err)
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("plugin: %v", err)
+	}
+
+	// records are written while responses are read, so a plugin that answers
+	// as it goes never blocks on a full pipe.
+	go func() {
+		encoder := json.NewEncoder(stdin)
+		for index, meta := range metas {
+			if encoder.Encode(PluginRecord{ID: index, Path: meta.Path, Tags: PluginRecordTags(meta)}) != nil {
+				break
+			}
+		}
+		stdin.Close()
+	}()
+
+	responses := make(chan PluginResponse)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- readPluginResponses(stdout, responses)
+	}()
+
+	var failure error
+	answered := map[int]bool{}
+	timer := time.NewTimer(tp.Timeout)
+	defer timer.Stop()
+	for failure == nil && len(answered) < len(metas) {
+		select {
+		case response, isOpen := <-responses:
+			if !isOpen {
+				failure = fmt.Errorf("plugin: exited without answering")
+				if err := <-readErr; err != nil {
+					failure = fmt.Errorf("plugin: %v", err)
+				}
+				continue
+			}
+			if response.ID < 0 || response.ID >= len(metas) || answered[response.ID] {
+				log.Printf("plugin: ignoring a response for an unknown or answered id %d", response.ID)
+				continue
+			}
+			answered[response.ID] = true
+			meta := metas[response.ID]
+			if len(response.Error) > 0 {
+				meta.ExtErr = fmt.Errorf("plugin: %s", response.Error)
+			} else {
+				meta.ExtTags = response.Tags
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(tp.Timeout)
+		case <-timer.C:
+			failure = fmt.Errorf("plugin: no answer within %v", tp.Timeout)
+			cmd.Process.Kill()
+		}
+	}
+	if failure != nil {
+		log.Println(failure)
+		for index, meta := range metas {
+			if !answered[index] {
+				meta.ExtErr = failure
+			}
+		}
+	}
+
+	// once every file is answered the plugin should exit at the end of its
+	// input; one that doesn't is killed.
+	go func() {
+		for range responses {
+		}
+	}()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case err := <-exited:
+		if err != nil && failure == nil {
+			log.Printf("plugin: %v", err)
+		}
+	case <-time.After(tp.Timeout):
+		cmd.Process.Kill()
+		<-exited
+	}
+	return nil
+}
+
+// readPluginResponses reads response lines until the plugin closes stdout.
+// Lines that aren't valid responses are logged and skipped.
+func readPluginResponses(r io.Reader, responses chan<- PluginResponse) error {
+	defer close(responses)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var line int
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var response PluginResponse
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			log.Printf("plugin: invalid response on line %d: %v", line, err)
+			continue
+		}
+		responses <- response
+	}
+	return scanner.Err()
+}
+
+// PluginRecordTags returns the tags a plugin is sent for a file: every exif
+// field and every computed tag that doesn't depend on the order of the run.
+func PluginRecordTags(meta *FileMetadata) map[string]string {
+	return resolvedTags(NewDateIndexCollector(), meta, func(name string) bool {
+		return IsIndexTag(name) || strings.HasPrefix(name, "File.Hash")
+	})
+}
+
+// GetExtTagValue gets an `Ext` tag value; a tag the plugin returned for the
+// file.
+func GetExtTagValue(meta *FileMetadata, tag string, properties ...string) (string, error) {
+	if len(properties) != 1 {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("an Ext tag takes a single name, e.g. Ext.assetId"))
+	}
+	if meta.ExtErr != nil {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag+"."+properties[0], meta.ExtErr)
+	}
+	value, hasValue := meta.ExtTags[properties[0]]
+	if !hasValue {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag+"."+properties[0], fmt.Errorf("the plugin didn't return it"))
+	}
+	return value, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+const testPluginModeEnv = "IMAGE_RENAME_TEST_PLUGIN"
+
+// TestHelperPlugin isn't a test; it is the plugin the plugin tests run, as the
+// test binary started with testPluginModeEnv set.
+func TestHelperPlugin(t *testing.T) {
+	mode := os.Getenv(testPluginModeEnv)
+	if len(mode) == 0 {
+		return
+	}
+
+	var records []PluginRecord
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var record PluginRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		records = append(records, record)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	switch mode {
+	case "answer":
+		{
+			fmt.Println("not json")
+			// answer out of order.
+			for index := len(records) - 1; index >= 0; index-- {
+				record := records[index]
+				name := strings.TrimSuffix(filepath.Base(record.Path), filepath.Ext(record.Path))
+				if name == "fail" {
+					encoder.Encode(PluginResponse{ID: record.ID, Error: "unknown asset"})
+					continue
+				}
+				encoder.Encode(PluginResponse{ID: record.ID, Tags: map[string]string{"assetId": "asset-" + name, "make": record.Tags["Make"]}})
+			}
+		}
+	case "exit":
+		{
+			encoder.Encode(PluginResponse{ID: records[0].ID, Tags: map[string]string{"assetId": "first"}})
+		}
+	case "hang":
+		{
+			time.Sleep(time.Minute)
+		}
+	}
+	os.Exit(0)
+}
+
+func testPlugin(mode string, timeout time.Duration) *TagPlugin {
+	os.Setenv(testPluginModeEnv, mode)
+	return &TagPlugin{Command: os.Args[0], Args: []string{"-test.run=TestHelperPlugin"}, Timeout: timeout}
+}
+
+func testPluginMetas(names ...string) []*FileMetadata {
+	var metas []*FileMetadata
+	for _, name := range names {
+		metas = append(metas, &FileMetadata{Path: name, Exif: ExifTags{"Make": "Canon"}})
+	}
+	return metas
+}
+
+func TestTagPluginProvide(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Unsetenv(testPluginModeEnv)
+
+	metas := testPluginMetas("a.jpg", "fail.jpg", "b.jpg")
+	assert.Nil(testPlugin("answer", 5*time.Second).Provide(metas))
+
+	value, err := GetTagValue(NewDateIndexCollector(), metas[0], "Ext.assetId")
+	assert.Nil(err)
+	assert.Equal("asset-a", value)
+	value, err = GetTagValue(NewDateIndexCollector(), metas[2], "Ext.make")
+	assert.Nil(err)
+	assert.Equal("Canon", value)
+
+	_, err = GetTagValue(NewDateIndexCollector(), metas[1], "Ext.assetId")
+	assert.NotNil(err)
+	assert.Equal(ErrorKindMissingTag, ErrorKindOf(err))
+	assert.True(strings.Contains(err.Error(), "unknown asset"))
+
+	_, err = GetTagValue(NewDateIndexCollector(), metas[0], "Ext.missing")
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "didn't return it"))
+}
+
+func TestTagPluginFailures(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Unsetenv(testPluginModeEnv)
+
+	metas := testPluginMetas("a.jpg", "b.jpg")
+	assert.Nil(testPlugin("exit", 5*time.Second).Provide(metas))
+	assert.Equal("first", metas[0].ExtTags["assetId"])
+	assert.NotNil(metas[1].ExtErr)
+	assert.True(strings.Contains(metas[1].ExtErr.Error(), "exited"))
+
+	metas = testPluginMetas("a.jpg")
+	started := time.Now()
+	assert.Nil(testPlugin("hang", 200*time.Millisecond).Provide(metas))
+	assert.True(time.Since(started) < 10*time.Second)
+	assert.NotNil(metas[0].ExtErr)
+	assert.True(strings.Contains(metas[0].ExtErr.Error(), "no answer"))
+
+	plugin, err := NewTagPlugin(filepath.Join(os.TempDir(), "image-rename-no-such-plugin"), time.Second)
+	assert.Nil(err)
+	assert.NotNil(plugin.Provide(testPluginMetas("a.jpg")))
+
+	_, err = NewTagPlugin(" ", time.Second)
+	assert.NotNil(err)
+}
+
+func TestNewTagPlugin(t *testing.T) {
+	assert := assert.New(t)
+
+	plugin, err := NewTagPlugin(`  "/opt/my plugins/assets" --db "C:\asset db.sqlite"  --name="a b" "" `, time.Second)
+	assert.Nil(err)
+	assert.Equal("/opt/my plugins/assets", plugin.Command)
+	assert.Equal([]string{"--db", `C:\asset db.sqlite`, "--name=a b", ""}, plugin.Args)
+
+	plugin, err = NewTagPlugin("assets --verbose", time.Second)
+	assert.Nil(err)
+	assert.Equal("assets", plugin.Command)
+	assert.Equal([]string{"--verbose"}, plugin.Args)
+
+	_, err = NewTagPlugin(`"/opt/my plugins/assets`, time.Second)
+	assert.NotNil(err)
+	_, err = NewTagPlugin(`"" --verbose`, time.Second)
+	assert.NotNil(err)
+}
+
+func TestPluginRecordTags(t *testing.T) {
+	assert := assert.New(t)
+
+	info, err := os.Stat(os.Args[0])
+	assert.Nil(err)
+	tags := PluginRecordTags(&FileMetadata{Path: os.Args[0], Info: info, Exif: ExifTags{"Make": "Canon"}})
+	assert.Equal("Canon", tags["Make"])
+	assert.Equal(filepath.Base(os.Args[0]), tags["File.Name"])
+	_, hasIndex := tags["Index"]
+	assert.False(hasIndex)
+	_, hasHash := tags["File.Hash"]
+	assert.False(hasHash)
+}
+
+func TestApplyPatternPlugin(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Unsetenv(testPluginModeEnv)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	options := renameTestOptions(dir + "/id_{Ext.assetId}.{File.Extension}")
+	options.Plugin = testPlugin("answer", 5*time.Second)
+	options.Plan = &RenamePlan{}
+	summary, err := ApplyPattern(renameTestFiles(assert, dir), ExtractFileOutputTags(options.OutputFilePattern), options)
+	assert.Nil(err)
+	assert.Equal(2, summary.Processed)
+	assert.Len(options.Plan.Renames, 2)
+	assert.Equal(filepath.Join(dir, "id_asset-a.txt"), options.Plan.Renames[0].To)
+	assert.Equal(filepath.Join(dir, "id_asset-b.txt"), options.Plan.Renames[1].To)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// RenameOptions are the options for a rename run.
+type RenameOptions struct {
+	OutputFilePattern string
+	Template          *template.Template
+	Script            *Script
+	Plugin            *TagPlugin
+	Lookups           []*LookupTable
+	Dest              string
+	OnError           ErrorPolicy
+	Duplicates        DuplicatePolicy
+	DuplicatesDir     string
+	Jobs              int
+	DryRun            bool
+	AssumeYes         bool
+	Similar           bool
+	SimilarThreshold  int
+	SequenceGap       time.Duration
+	EventGap          time.Duration
+	EventDistance     float64
+	EventNames        []EventName
+	Cache             *MetadataCache
+	Collector         *DateIndexCollector
+	Renumber          bool
+	Journal           string
+	UndoLog           string
+	Where             *WhereExpression
+	Plan              *RenamePlan
+}
+
+// ApplyPattern applies the rename pattern to the files.
+// Files that fail are handled according to the error policy; the returned
+// error is only set if the run was aborted.
+func ApplyPattern(files, fileTags []string, options RenameOptions) (*RunSummary, error) {
+	summary := NewRunSummary()
+	collector := options.Collector
+	if collector == nil {
+		collector = NewDateIndexCollector()
+	}
+
+	// metadata is read in parallel, but indexes are assigned in file order.
+	metas := ExtractMetadata(files, options.Jobs, options.Cache)
+
+	// the where expression can use computed tags, so files are grouped and
+	// given their plugin and lookup tags before they are selected. Files
+	// without a capture time are grouped by their modification time if the
+	// error policy allows it, and are otherwise left out.
+	var grouped []*FileMetadata
+	for _, meta := range metas {
+		if meta.Err != nil {
+			if !options.OnError.CanFallback(meta.Err) || meta.Info == nil {
+				continue
+			}
+			meta.CaptureTime = meta.Info.ModTime()
+		}
+		grouped = append(grouped, meta)
+	}
+	DetectSequences(grouped, options.SequenceGap)
+	ClusterEvents(grouped, options.EventGap, options.EventDistance, options.EventNames)
+	if options.Similar {
+		ComputePerceptualHashes(grouped, options.Jobs, options.Cache)
+		GroupSimilar(grouped, options.SimilarThreshold)
+	}
+	if options.Plugin != nil {
+		if err := options.Plugin.Provide(grouped); err != nil {
+			return summary, err
+		}
+	}
+	ApplyLookups(grouped, options.Lookups)
+	metas = FilterWhere(metas, options.Where)
+
+	var duplicates map[*FileMetadata]bool
+	if options.Duplicates != DuplicatePolicyNone {
+		var err error
+		duplicates, err = ResolveDuplicates(FindDuplicates(metas, options.Jobs), options, summary)
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	// files without a capture time either fall back to their modification
+	// time or are handled by the error policy before any file is renamed.
+	var renames []*FileMetadata
+	for _, meta := range metas {
+		if duplicates[meta] {
+			continue
+		}
+		if meta.Err != nil {
+			if !options.OnError.CanFallback(meta.Err) || meta.Info == nil {
+				fileErr := AsFileError(meta.Path, meta.Err)
+				if options.OnError == ErrorPolicyAbort {
+					return summary, fileErr
+				}
+				summary.Skip(fileErr)
+				continue
+			}
+			summary.Fallback(AsFileError(meta.Path, meta.Err))
+			meta.CaptureTime = meta.Info.ModTime()
+		}
+		renames = append(renames, meta)
+	}
+
+	// files that are already named by the pattern are left untouched, and their
+	// indexes are reserved so reruns don't renumber them. Names made by a
+	// template can't be matched.
+	conforming := map[*FileMetadata]bool{}
+	if !options.Renumber && options.Template == nil {
+		var err error
+		if conforming, err = ReserveConformingFiles(collector, renames, options.OutputFilePattern); err != nil {
+			return summary, err
+		}
+	}
+
+	// every target is planned before any file moves, so renames onto the
+	// current name of another file in the run can be ordered.
+	var planned []RenameStep
+	for _, meta := range renames {
+		if conforming[meta] {
+			if options.DryRun {
+				fmt.Printf("%s (unchanged)\n", meta.Path)
+			}
+			summary.AlreadyNamed()
+			continue
+		}
+		target, err := planFileRename(collector, summary, meta, fileTags, options)
+		if err != nil {
+			fileErr := AsFileError(meta.Path, err)
+			if options.OnError == ErrorPolicyAbort {
+				return summary, fileErr
+			}
+			summary.Skip(fileErr)
+			continue
+		}
+		if isSamePath(target, meta.Path) {
+			if options.DryRun {
+				fmt.Printf("%s (unchanged)\n", meta.Path)
+			}
+			summary.AlreadyNamed()
+			continue
+		}
+		planned = append(planned, RenameStep{From: meta.Path, To: target})
+	}
+
+	return summary, RunRenames(summary, planned, options)
+}
+
+// RunRenames validates and runs planned renames, recording the outcome of
+// each in the summary, and records the renames that were run in the undo log.
+// With a plan set, the renames are added to the plan instead, and with dryrun
+// set they are printed. The returned error is only set if the run was
+// aborted.
+func RunRenames(summary *RunSummary, planned []RenameStep, options RenameOptions) error {
+	valid, errs := ValidateRenames(planned)
+	for _, fileErr := range errs {
+		if options.OnError == ErrorPolicyAbort {
+			return fileErr
+		}
+		summary.Skip(fileErr)
+	}
+
+	if options.Plan != nil {
+		for _, rename := range valid {
+			options.Plan.Add(rename.From, rename.To)
+			summary.Success()
+		}
+		return nil
+	}
+	if options.DryRun {
+		for _, rename := range valid {
+			fmt.Printf("%s => %s\n", rename.From, rename.To)
+			summary.Success()
+		}
+		return nil
+	}
+
+	renamed, failed, err := ExecuteRenames(OrderRenames(valid), options.Journal, options.OnError == ErrorPolicyAbort)
+	var abortErr *FileError
+	undo := &RenamePlan{}
+	for index, rename := range valid {
+		if renamed[index] {
+			undo.Add(rename.From, rename.To)
+			summary.Rename(rename.To)
+		}
+		if renameErr, hasFailed := failed[index]; hasFailed {
+			fileErr := NewFileError(ErrorKindIO, rename.From, "", renameErr)
+			if options.OnError == ErrorPolicyAbort {
+				abortErr = fileErr
+				continue
+			}
+			summary.Skip(fileErr)
+		}
+	}
+	// a run that renamed nothing keeps the undo log of the last one that did.
+	if len(options.UndoLog) > 0 && len(undo.Renames) > 0 {
+		if undoErr := SaveRenamePlan(options.UndoLog, undo); undoErr != nil && err == nil {
+			err = undoErr
+		}
+	}
+	if abortErr != nil {
+		return abortErr
+	}
+	return err
+}
+
+// planFileRename returns the target name for a single file.
+func planFileRename(collector *DateIndexCollector, summary *RunSummary, meta *FileMetadata, fileTags []string, options RenameOptions) (string, error) {
+	collector.Add(meta.CaptureTime)
+	if options.Script != nil {
+		result, err := options.Script.Run(meta.Path, ScriptInputTags(collector, meta))
+		if err != nil {
+			return "", err
+		}
+		if len(result.Name) > 0 {
+			return DestinationPattern(options.Dest, result.Name), nil
+		}
+		meta.ScriptTags = result.Tags
+	}
+	if options.Template != nil {
+		return RenderTemplate(options.Template, collector, meta)
+	}
+
+	values := make([]string, len(fileTags))
+	for index, tag := range fileTags {
+		value, err := GetTagValue(collector, meta, tag)
+		if err != nil {
+			if !options.OnError.CanFallback(err) {
+				return "", err
+			}
+			summary.Fallback(AsFileError(meta.Path, err))
+		}
+		values[index] = value
+	}
+	return ReplaceTagsInPattern(options.OutputFilePattern, fileTags, values), nil
+}
+
+// isSamePath returns if two paths resolve to the same absolute path.
+func isSamePath(a, b string) bool {
+	return absolutePath(a) == absolutePath(b)
+}
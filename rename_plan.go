@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultRenameJournalFile is the journal file, relative to the working
+// directory, that records a rename plan while it is executed.
+const DefaultRenameJournalFile = ".image-rename-journal"
+
+// DefaultUndoLogFile is the file, relative to the working directory, that
+// records the renames of the last run so they can be undone.
+const DefaultUndoLogFile = ".image-rename-undo"
+
+// RenameStep is a single rename in a plan. Index is the index of the planned
+// rename the step belongs to; a rename that is part of a cycle takes two
+// steps, the first of which moves the file to a temporary name.
+type RenameStep struct {
+	Index     int    `json:"index"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Temporary bool   `json:"temporary,omitempty"`
+}
+
+// renameJournalLine is a line of a rename journal; the first line holds the
+// steps, and every following line marks a step as done.
+type renameJournalLine struct {
+	Steps []RenameStep `json:"steps,omitempty"`
+	Done  *int         `json:"done,omitempty"`
+}
+
+// RenamePlan is a list of renames; it is written by the `plan` command and
+// read by `apply`, and the undo log is the plan of the last run.
+type RenamePlan struct {
+	Renames []RenameStep `json:"renames"`
+}
+
+// Add adds a rename between the absolute forms of two paths, so the plan can
+// be run from any directory.
+func (rp *RenamePlan) Add(from, to string) {
+	rp.Renames = append(rp.Renames, RenameStep{Index: len(rp.Renames), From: absolutePath(from), To: absolutePath(to)})
+}
+
+// Invert returns a plan that reverses the renames.
+func (rp *RenamePlan) Invert() *RenamePlan {
+	inverted := &RenamePlan{}
+	for _, rename := range rp.Renames {
+		inverted.Add(rename.To, rename.From)
+	}
+	return inverted
+}
+
+// WriteTo writes the plan as json.
+func (rp *RenamePlan) WriteTo(w io.Writer) (int64, error) {
+	contents, err := json.MarshalIndent(rp, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(contents, '\n'))
+	return int64(n), err
+}
+
+// DecodeRenamePlan reads a plan written by RenamePlan.WriteTo.
+func DecodeRenamePlan(r io.Reader) (*RenamePlan, error) {
+	var plan RenamePlan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("plan: %v", err)
+	}
+	for index, rename := range plan.Renames {
+		if len(rename.From) == 0 || len(rename.To) == 0 {
+			return nil, fmt.Errorf("plan: rename %d is missing a path", index)
+		}
+	}
+	return &plan, nil
+}
+
+// ReadRenamePlan reads a plan from a file, or from stdin if the path is `-`.
+func ReadRenamePlan(path string) (*RenamePlan, error) {
+	if path == "-" {
+		return DecodeRenamePlan(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return DecodeRenamePlan(file)
+}
+
+// SaveRenamePlan writes a plan to a file.
+func SaveRenamePlan(path string, plan *RenamePlan) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err = plan.WriteTo(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// ValidateRenames checks that no two renames share a target and that no
+// target exists unless it is itself being renamed, returning the renames that
+// can go ahead and an error for each that cannot.
+func ValidateRenames(renames []RenameStep) ([]RenameStep, []*FileError) {
+	sources := map[string]bool{}
+	for _, rename := range renames {
+		sources[absolutePath(rename.From)] = true
+	}
+
+	var valid []RenameStep
+	var errs []*FileError
+	targets := map[string]string{}
+	for _, rename := range renames {
+		target := absolutePath(rename.To)
+		if other, hasTarget := targets[target]; hasTarget {
+			errs = append(errs, NewFileError(ErrorKindIO, rename.From, "", fmt.Errorf("rename: %s is also the target of %s", rename.To, other)))
+			continue
+		}
+		if _, err := os.Lstat(target); err == nil && !sources[target] {
+			errs = append(errs, NewFileError(ErrorKindIO, rename.From, "", fmt.Errorf("rename: %s already exists", rename.To)))
+			continue
+		}
+		targets[target] = rename.From
+		valid = append(valid, rename)
+	}
+	return valid, errs
+}
+
+// OrderRenames orders renames so that no file is renamed onto a file that
+// hasn't been moved out of the way yet. A chain of renames runs from its end,
+// and a cycle is broken by moving its first file to a temporary name and
+// moving it to its target last. Each step's index is set to the index of its
+// rename, and its paths are made absolute so a journal of the steps can be
+// recovered from any directory.
+func OrderRenames(renames []RenameStep) []RenameStep {
+	bySource := map[string]int{}
+	for index, rename := range renames {
+		bySource[absolutePath(rename.From)] = index
+	}
+	// blocker returns the rename that has to run before a given rename.
+	blocker := func(index int) (int, bool) {
+		blockerIndex, isBlocked := bySource[absolutePath(renames[index].To)]
+		return blockerIndex, isBlocked && blockerIndex != index
+	}
+
+	done := make([]bool, len(renames))
+	var steps []RenameStep
+	step := func(index int, from, to string, temporary bool) {
+		steps = append(steps, RenameStep{Index: index, From: absolutePath(from), To: absolutePath(to), Temporary: temporary})
+	}
+	for start := range renames {
+		if done[start] {
+			continue
+		}
+
+		// targets and sources are unique, so a chain either ends at a free
+		// target or comes back around to where it started.
+		chain := []int{start}
+		inChain := map[int]bool{start: true}
+		var isCycle bool
+		for current := start; ; {
+			next, isBlocked := blocker(current)
+			if !isBlocked || done[next] {
+				break
+			}
+			if inChain[next] {
+				isCycle = true
+				break
+			}
+			chain = append(chain, next)
+			inChain[next] = true
+			current = next
+		}
+
+		first := chain[0]
+		if isCycle {
+			tempPath := temporaryRenamePath(renames[first].From, first)
+			step(first, renames[first].From, tempPath, true)
+			for index := len(chain) - 1; index > 0; index-- {
+				step(chain[index], renames[chain[index]].From, renames[chain[index]].To, false)
+			}
+			step(first, tempPath, renames[first].To, false)
+		} else {
+			for index := len(chain) - 1; index >= 0; index-- {
+				step(chain[index], renames[chain[index]].From, renames[chain[index]].To, false)
+			}
+		}
+		for _, index := range chain {
+			done[index] = true
+		}
+	}
+	return steps
+}
+
+// temporaryRenamePath returns a hidden name next to a file to park it on.
+func temporaryRenamePath(filePath string, index int) string {
+	return filepath.Join(filepath.Dir(filePath), fmt.Sprintf(".%s.%d.rename", filepath.Base(filePath), index))
+}
+
+// ExecuteRenames runs ordered rename steps, recording them in a journal first
+// so an interrupted run can be recovered with RecoverRenameJournal. A step
+// never replaces an existing file. It returns the rename indexes that reached
+// their target and the error for each that failed; if abort is set it stops
+// at the first failure. A file parked on a temporary name by a rename that
+// failed is moved back. The journal is removed once the steps have run, even
+// if some failed, so it only survives an interrupted run.
+func ExecuteRenames(steps []RenameStep, journalPath string, abort bool) (map[int]bool, map[int]error, error) {
+	var journal *os.File
+	if len(journalPath) > 0 {
+		var err error
+		if journal, err = createRenameJournal(journalPath, steps); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	renamed := map[int]bool{}
+	failed := map[int]error{}
+	for stepIndex, step := range steps {
+		if _, hasFailed := failed[step.Index]; hasFailed {
+			continue
+		}
+		if err := renameNoReplace(step.From, step.To); err != nil {
+			failed[step.Index] = err
+			if abort {
+				break
+			}
+			continue
+		}
+		if !step.Temporary {
+			renamed[step.Index] = true
+		}
+		if journal != nil {
+			if err := writeRenameJournalLine(journal, renameJournalLine{Done: &stepIndex}); err != nil {
+				journal.Close()
+				return renamed, failed, err
+			}
+		}
+	}
+
+	for _, step := range steps {
+		if !step.Temporary || renamed[step.Index] {
+			continue
+		}
+		if _, err := os.Lstat(step.To); err == nil {
+			if err = renameNoReplace(step.To, step.From); err != nil {
+				failed[step.Index] = fmt.Errorf("%v; the file was left at %s", failed[step.Index], step.To)
+			}
+		}
+	}
+
+	if journal == nil {
+		return renamed, failed, nil
+	}
+	if err := journal.Close(); err != nil {
+		return renamed, failed, err
+	}
+	return renamed, failed, os.Remove(journalPath)
+}
+
+// RecoverRenameJournal finishes the steps of an interrupted rename plan and
+// removes the journal, returning the number of steps that were run and an
+// error for each step that still failed. It does nothing if there is no
+// journal. Steps that were done but not yet recorded are detected by their
+// source being gone and their target existing, and the partial copy of a move
+// across devices that was cut short is removed before its step is run again.
+func RecoverRenameJournal(journalPath string) (int, []error, error) {
+	file, err := os.Open(journalPath)
+	if os.IsNotExist(err) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var steps []RenameStep
+	done := map[int]bool{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var line renameJournalLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// the last line may have been cut short by the interruption.
+			break
+		}
+		if line.Done != nil {
+			done[*line.Done] = true
+		} else if line.Steps != nil {
+			steps = line.Steps
+		}
+	}
+	file.Close()
+	if err = scanner.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	var recovered int
+	var errs []error
+	for stepIndex, step := range steps {
+		if done[stepIndex] {
+			continue
+		}
+		if err := os.Remove(moveCopyPath(step.To)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, NewFileError(ErrorKindIO, step.From, "", err))
+			continue
+		}
+		if _, err := os.Lstat(step.From); os.IsNotExist(err) {
+			if _, err := os.Lstat(step.To); err == nil {
+				continue
+			}
+		}
+		if err := renameNoReplace(step.From, step.To); err != nil {
+			errs = append(errs, NewFileError(ErrorKindIO, step.From, "", err))
+			continue
+		}
+		recovered++
+	}
+	return recovered, errs, os.Remove(journalPath)
+}
+
+func createRenameJournal(journalPath string, steps []RenameStep) (*os.File, error) {
+	if _, err := os.Lstat(journalPath); err == nil {
+		return nil, fmt.Errorf("rename journal %s exists; a previous run was interrupted", journalPath)
+	}
+	journal, err := os.OpenFile(journalPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeRenameJournalLine(journal, renameJournalLine{Steps: steps}); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	// the plan has to be on disk before the first file moves.
+	if err = journal.Sync(); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	return journal, nil
+}
+
+func writeRenameJournalLine(journal *os.File, line renameJournalLine) error {
+	contents, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = journal.Write(append(contents, '\n'))
+	return err
+}
+
+// renameNoReplace moves a file, failing if the target exists.
+func renameNoReplace(from, to string) error {
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("rename: %s already exists", to)
+	}
+	return MoveFile(from, to)
+}
+
+// absolutePath returns the absolute form of a path, or the path itself if it
+// cannot be made absolute.
+func absolutePath(filePath string) string {
+	if absolute, err := filepath.Abs(filePath); err == nil {
+		return absolute
+	}
+	return filePath
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestOrderRenamesChain(t *testing.T) {
+	assert := assert.New(t)
+
+	steps := OrderRenames([]RenameStep{
+		{From: "/p/a", To: "/p/b"},
+		{From: "/p/b", To: "/p/c"},
+		{From: "/p/x", To: "/p/y"},
+	})
+	assert.Len(steps, 3)
+	assert.Equal("/p/b", steps[0].From)
+	assert.Equal(1, steps[0].Index)
+	assert.Equal("/p/a", steps[1].From)
+	assert.Equal(0, steps[1].Index)
+	assert.Equal("/p/x", steps[2].From)
+
+	steps = OrderRenames([]RenameStep{{From: "a.jpg", To: "out/b.jpg"}})
+	assert.Equal(absolutePath("a.jpg"), steps[0].From)
+	assert.Equal(absolutePath("out/b.jpg"), steps[0].To)
+}
+
+func TestOrderRenamesCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	steps := OrderRenames([]RenameStep{
+		{From: "/p/a", To: "/p/b"},
+		{From: "/p/b", To: "/p/c"},
+		{From: "/p/c", To: "/p/a"},
+	})
+	assert.Len(steps, 4)
+	assert.True(steps[0].Temporary)
+	assert.Equal("/p/a", steps[0].From)
+	assert.Equal(RenameStep{Index: 2, From: "/p/c", To: "/p/a"}, steps[1])
+	assert.Equal(RenameStep{Index: 1, From: "/p/b", To: "/p/c"}, steps[2])
+	assert.Equal(RenameStep{Index: 0, From: steps[0].To, To: "/p/b"}, steps[3])
+}
+
+func TestValidateRenames(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a", "b", "kept"} {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	valid, errs := ValidateRenames([]RenameStep{
+		{From: filepath.Join(dir, "a"), To: filepath.Join(dir, "b")},
+		{From: filepath.Join(dir, "b"), To: filepath.Join(dir, "kept")},
+		{From: filepath.Join(dir, "c"), To: filepath.Join(dir, "b")},
+	})
+	assert.Len(valid, 1)
+	assert.Equal(filepath.Join(dir, "a"), valid[0].From)
+	assert.Len(errs, 2)
+}
+
+func TestExecuteRenames(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for _, name := range []string{"a", "b", "c", "d"} {
+		assert.Nil(ioutil.WriteFile(path(name), []byte(name), 0644))
+	}
+
+	renames := []RenameStep{
+		{From: path("a"), To: path("b")},
+		{From: path("b"), To: path("a")},
+		{From: path("c"), To: path("d")},
+		{From: path("d"), To: path("e")},
+	}
+	journalPath := path(DefaultRenameJournalFile)
+	renamed, failed, err := ExecuteRenames(OrderRenames(renames), journalPath, true)
+	assert.Nil(err)
+	assert.Empty(failed)
+	assert.Len(renamed, 4)
+
+	for name, contents := range map[string]string{"a": "b", "b": "a", "d": "c", "e": "d"} {
+		actual, err := ioutil.ReadFile(path(name))
+		assert.Nil(err)
+		assert.Equal(contents, string(actual))
+	}
+	_, err = os.Stat(path("c"))
+	assert.True(os.IsNotExist(err))
+	_, err = os.Stat(journalPath)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestExecuteRenamesFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for _, name := range []string{"a", "b", "blocker"} {
+		assert.Nil(ioutil.WriteFile(path(name), []byte(name), 0644))
+	}
+
+	// b can't be moved into a directory named like a file; the run goes on
+	// and finishes, so there is nothing to recover.
+	journalPath := path(DefaultRenameJournalFile)
+	renames := []RenameStep{
+		{From: path("a"), To: path("c")},
+		{From: path("b"), To: filepath.Join(path("blocker"), "b")},
+	}
+	renamed, failed, err := ExecuteRenames(OrderRenames(renames), journalPath, false)
+	assert.Nil(err)
+	assert.Equal(map[int]bool{0: true}, renamed)
+	assert.Len(failed, 1)
+	assert.NotNil(failed[1])
+	_, err = os.Stat(journalPath)
+	assert.True(os.IsNotExist(err))
+
+	recovered, errs, err := RecoverRenameJournal(journalPath)
+	assert.Nil(err)
+	assert.Empty(errs)
+	assert.Equal(0, recovered)
+	_, err = os.Stat(path("b"))
+	assert.Nil(err)
+}
+
+func TestRecoverRenameJournal(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// a swap of a and b was interrupted after a was parked, and after b was
+	// renamed onto a but before that step was recorded.
+	steps := OrderRenames([]RenameStep{{From: path("a"), To: path("b")}, {From: path("b"), To: path("a")}})
+	assert.Nil(ioutil.WriteFile(steps[0].To, []byte("a"), 0644))
+	assert.Nil(ioutil.WriteFile(path("a"), []byte("b"), 0644))
+
+	journalPath := path(DefaultRenameJournalFile)
+	header, err := json.Marshal(renameJournalLine{Steps: steps})
+	assert.Nil(err)
+	assert.Nil(ioutil.WriteFile(journalPath, append(header, []byte("\n{\"done\":0}\n{\"do")...), 0644))
+
+	recovered, errs, err := RecoverRenameJournal(journalPath)
+	assert.Nil(err)
+	assert.Empty(errs)
+	assert.Equal(1, recovered)
+	for name, contents := range map[string]string{"a": "b", "b": "a"} {
+		actual, err := ioutil.ReadFile(path(name))
+		assert.Nil(err)
+		assert.Equal(contents, string(actual))
+	}
+	_, err = os.Stat(journalPath)
+	assert.True(os.IsNotExist(err))
+
+	recovered, errs, err = RecoverRenameJournal(journalPath)
+	assert.Nil(err)
+	assert.Empty(errs)
+	assert.Equal(0, recovered)
+
+	// a move across devices was interrupted while c was being copied.
+	header, err = json.Marshal(renameJournalLine{Steps: []RenameStep{{From: path("c"), To: path("d")}}})
+	assert.Nil(err)
+	assert.Nil(ioutil.WriteFile(journalPath, append(header, '\n'), 0644))
+	assert.Nil(ioutil.WriteFile(path("c"), []byte("c"), 0644))
+	assert.Nil(ioutil.WriteFile(moveCopyPath(path("d")), []byte("partial"), 0644))
+
+	recovered, errs, err = RecoverRenameJournal(journalPath)
+	assert.Nil(err)
+	assert.Empty(errs)
+	assert.Equal(1, recovered)
+	actual, err := ioutil.ReadFile(path("d"))
+	assert.Nil(err)
+	assert.Equal("c", string(actual))
+	_, err = os.Stat(path(".d.copy"))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestRenamePlanRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	plan := &RenamePlan{}
+	plan.Add("/p/a", "/p/b")
+	plan.Add("/p/c", "/p/d")
+	var buffer bytes.Buffer
+	_, err := plan.WriteTo(&buffer)
+	assert.Nil(err)
+
+	decoded, err := DecodeRenamePlan(&buffer)
+	assert.Nil(err)
+	assert.Equal(plan.Renames, decoded.Renames)
+	assert.Equal(RenameStep{Index: 1, From: "/p/d", To: "/p/c"}, decoded.Invert().Renames[1])
+
+	_, err = DecodeRenamePlan(bytes.NewBufferString(`{"renames": [{"from": "/p/a"}]}`))
+	assert.NotNil(err)
+	_, err = DecodeRenamePlan(bytes.NewBufferString(`not json`))
+	assert.NotNil(err)
+}
+
+func TestRunRenamesUndo(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a", "b"} {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	options := RenameOptions{
+		OnError: ErrorPolicySkip,
+		Journal: filepath.Join(dir, DefaultRenameJournalFile),
+		UndoLog: filepath.Join(dir, DefaultUndoLogFile),
+	}
+	summary := NewRunSummary()
+	assert.Nil(RunRenames(summary, []RenameStep{
+		{From: filepath.Join(dir, "a"), To: filepath.Join(dir, "b")},
+		{From: filepath.Join(dir, "b"), To: filepath.Join(dir, "c")},
+	}, options))
+	assert.Equal(2, summary.Processed)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "c"))
+	assert.Nil(err)
+	assert.Equal("b", string(contents))
+
+	undo, err := ReadRenamePlan(options.UndoLog)
+	assert.Nil(err)
+	assert.Len(undo.Renames, 2)
+	assert.Nil(RunRenames(NewRunSummary(), undo.Invert().Renames, options))
+	for _, name := range []string{"a", "b"} {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(err)
+		assert.Equal(name, string(contents))
+	}
+
+	// a plan only collects the renames.
+	options.Plan = &RenamePlan{}
+	summary = NewRunSummary()
+	assert.Nil(RunRenames(summary, []RenameStep{{From: filepath.Join(dir, "a"), To: filepath.Join(dir, "d")}}, options))
+	assert.Len(options.Plan.Renames, 1)
+	assert.Equal(1, summary.Processed)
+	_, err = os.Stat(filepath.Join(dir, "a"))
+	assert.Nil(err)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func renameTestOptions(pattern string) RenameOptions {
+	return RenameOptions{
+		OutputFilePattern: pattern,
+		OnError:           ErrorPolicyFallback,
+		Duplicates:        DuplicatePolicyNone,
+		Jobs:              2,
+		SequenceGap:       DefaultSequenceGap,
+		EventGap:          DefaultEventGap,
+	}
+}
+
+func renameTestFiles(assert *assert.Assertions, dir string) []string {
+	filter, err := NewFileFilter("", nil, nil, nil, false)
+	assert.Nil(err)
+	files, err := FilesInDirectoryWithFilter(dir, filter)
+	assert.Nil(err)
+	sort.Strings(files)
+	return files
+}
+
+func TestApplyPatternIdempotent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name string, modTime time.Time) {
+		filePath := filepath.Join(dir, name)
+		assert.Nil(ioutil.WriteFile(filePath, []byte(name), 0644))
+		assert.Nil(os.Chtimes(filePath, modTime, modTime))
+	}
+	start := time.Date(2016, 8, 12, 9, 0, 0, 0, time.Local)
+	writeFile("c.txt", start)
+	writeFile("a.txt", start.Add(time.Minute))
+	writeFile("b.txt", start.Add(2*time.Minute))
+
+	pattern := filepath.ToSlash(dir) + "/{File.ModTime.Year}_{File.IndexByCaptureDate}.txt"
+	fileTags := ExtractFileOutputTags(pattern)
+	summary, err := ApplyPattern(renameTestFiles(assert, dir), fileTags, renameTestOptions(pattern))
+	assert.Nil(err)
+	assert.Equal(3, summary.Processed)
+	renamed := renameTestFiles(assert, dir)
+	assert.Equal(filepath.Join(dir, "2016_000003.txt"), renamed[2])
+
+	summary, err = ApplyPattern(renamed, fileTags, renameTestOptions(pattern))
+	assert.Nil(err)
+	assert.Equal(0, summary.Processed)
+	assert.Equal(3, summary.Unchanged)
+	assert.Equal(renamed, renameTestFiles(assert, dir))
+
+	writeFile("d.txt", start.Add(-time.Minute))
+	summary, err = ApplyPattern(renameTestFiles(assert, dir), fileTags, renameTestOptions(pattern))
+	assert.Nil(err)
+	assert.Equal(1, summary.Processed)
+	assert.Equal(3, summary.Unchanged)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "2016_000004.txt"))
+	assert.Nil(err)
+	assert.Equal("d.txt", string(contents))
+}
+
+func TestApplyPatternRenumberCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// the file named 000001 was modified last, so renumbering swaps the names.
+	start := time.Date(2016, 8, 12, 9, 0, 0, 0, time.Local)
+	for index, name := range []string{"000002.txt", "000001.txt"} {
+		filePath := filepath.Join(dir, name)
+		assert.Nil(ioutil.WriteFile(filePath, []byte(name), 0644))
+		modTime := start.Add(time.Duration(index) * time.Minute)
+		assert.Nil(os.Chtimes(filePath, modTime, modTime))
+	}
+
+	pattern := filepath.ToSlash(dir) + "/{File.Index}.txt"
+	options := renameTestOptions(pattern)
+	options.Renumber = true
+	options.Journal = filepath.Join(dir, DefaultRenameJournalFile)
+	files := []string{filepath.Join(dir, "000002.txt"), filepath.Join(dir, "000001.txt")}
+	summary, err := ApplyPattern(files, ExtractFileOutputTags(pattern), options)
+	assert.Nil(err)
+	assert.Equal(2, summary.Processed)
+	assert.Empty(summary.Skipped)
+
+	for name, contents := range map[string]string{"000001.txt": "000002.txt", "000002.txt": "000001.txt"} {
+		actual, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(err)
+		assert.Equal(contents, string(actual))
+	}
+	assert.Len(renameTestFiles(assert, dir), 2)
+}
+
+func TestApplyPatternWhereComputedTag(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// the first two files are one event and the last is the next.
+	start := time.Date(2016, 8, 12, 9, 0, 0, 0, time.Local)
+	for index, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		filePath := filepath.Join(dir, name)
+		assert.Nil(ioutil.WriteFile(filePath, []byte(name), 0644))
+		modTime := start.Add(time.Duration(index) * time.Minute)
+		if index == 2 {
+			modTime = start.Add(2 * DefaultEventGap)
+		}
+		assert.Nil(os.Chtimes(filePath, modTime, modTime))
+	}
+
+	where, err := ParseWhere("Event.Index == 2")
+	assert.Nil(err)
+	pattern := filepath.ToSlash(dir) + "/event_{Event.Index}_{Event.Index.Within}.txt"
+	options := renameTestOptions(pattern)
+	options.Where = where
+	options.Plan = &RenamePlan{}
+	summary, err := ApplyPattern(renameTestFiles(assert, dir), ExtractFileOutputTags(pattern), options)
+	assert.Nil(err)
+	assert.Equal(1, summary.Processed)
+	assert.Len(options.Plan.Renames, 1)
+	assert.Equal(filepath.Join(dir, "c.txt"), options.Plan.Renames[0].From)
+	assert.Equal(filepath.Join(dir, "event_000002_000001.txt"), options.Plan.Renames[0].To)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// DefaultScriptTimeout is how long the rename script may run for a file.
+const DefaultScriptTimeout = 5 * time.Second
+
+// ScriptFunction is the function a rename script defines.
+const ScriptFunction = "rename"
+
+// Script is a starlark rename script. It defines `rename(tags)`, which is
+// called for each file with a dict of the file's tags and returns the target
+// name, a dict of extra tags used as `{Script.name}`, or None to use the
+// output format as is.
+//
+// Scripts can't read files, use the network or load other modules, `while`
+// loops and recursion aren't allowed, and a call that runs for longer than the
+// timeout is cancelled.
+type Script struct {
+	Path    string
+	Timeout time.Duration
+
+	rename starlark.Callable
+}
+
+// scriptFileOptions are the language options of rename scripts; sets are
+// allowed, but `while` loops, recursion and top level statements other than
+// definitions aren't.
+var scriptFileOptions = &syntax.FileOptions{Set: true}
+
+// ScriptResult is what a rename script returns for a file.
+type ScriptResult struct {
+	Name string
+	Tags map[string]string
+}
+
+// LoadScript reads and runs a rename script, and returns its `rename`
+// function.
+func LoadScript(path string) (*Script, error) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	script := &Script{Path: path, Timeout: DefaultScriptTimeout}
+	globals, err := starlark.ExecFileOptions(scriptFileOptions, script.newThread(), path, source, scriptBuiltins)
+	if err != nil {
+		return nil, fmt.Errorf("script: %v", err)
+	}
+	rename, isCallable := globals[ScriptFunction].(starlark.Callable)
+	if !isCallable {
+		return nil, fmt.Errorf("script: %s doesn't define a %s(tags) function", path, ScriptFunction)
+	}
+	script.rename = rename
+	return script, nil
+}
+
+func (s *Script) newThread() *starlark.Thread {
+	return &starlark.Thread{
+		Name: s.Path,
+		Print: func(_ *starlark.Thread, message string) {
+			log.Printf("%s: %s", s.Path, message)
+		},
+	}
+}
+
+// Run calls the script's `rename` function for a file with its tags.
+func (s *Script) Run(path string, tags map[string]string) (ScriptResult, error) {
+	dict := starlark.NewDict(len(tags))
+	for name, value := range tags {
+		dict.SetKey(starlark.String(name), starlark.String(value))
+	}
+
+	type returned struct {
+		value starlark.Value
+		err   error
+	}
+	thread := s.newThread()
+	done := make(chan returned, 1)
+	go func() {
+		value, err := starlark.Call(thread, s.rename, starlark.Tuple{dict}, nil)
+		done <- returned{value: value, err: err}
+	}()
+
+	// a cancelled call stops at its next step.
+	var result returned
+	select {
+	case result = <-done:
+	case <-time.After(s.Timeout):
+		thread.Cancel("timed out")
+		<-done
+		return ScriptResult{}, NewFileError(ErrorKindScript, path, ScriptFunction, fmt.Errorf("timed out after %v", s.Timeout))
+	}
+	if result.err != nil {
+		return ScriptResult{}, NewFileError(ErrorKindScript, path, ScriptFunction, result.err)
+	}
+
+	switch value := result.value.(type) {
+	case starlark.NoneType:
+		return ScriptResult{}, nil
+	case starlark.String:
+		if len(value.GoString()) == 0 {
+			return ScriptResult{}, NewFileError(ErrorKindScript, path, ScriptFunction, fmt.Errorf("returned an empty name"))
+		}
+		return ScriptResult{Name: value.GoString()}, nil
+	case *starlark.Dict:
+		scriptTags := map[string]string{}
+		for _, item := range value.Items() {
+			name, isString := starlark.AsString(item[0])
+			if !isString {
+				return ScriptResult{}, NewFileError(ErrorKindScript, path, ScriptFunction, fmt.Errorf("returned a tag name that isn't a string: %s", item[0]))
+			}
+			if text, isText := starlark.AsString(item[1]); isText {
+				scriptTags[name] = text
+				continue
+			}
+			if item[1] != starlark.None {
+				scriptTags[name] = item[1].String()
+			}
+		}
+		return ScriptResult{Tags: scriptTags}, nil
+	}
+	return ScriptResult{}, NewFileError(ErrorKindScript, path, ScriptFunction, fmt.Errorf("must return a string, a dict or None, not %s", result.value.Type()))
+}
+
+// ScriptInputTags returns the tags a rename script is called with: every exif
+// field of a file, every computed tag that resolves for it except the file
+// hash, which would read every file, and its plugin and lookup tags.
+func ScriptInputTags(collector *DateIndexCollector, meta *FileMetadata) map[string]string {
+	tags := resolvedTags(collector, meta, func(name string) bool {
+		return strings.HasPrefix(name, "File.Hash")
+	})
+	for name, value := range meta.ExtTags {
+		tags["Ext."+name] = value
+	}
+	for table, row := range LookupRows(meta) {
+		for column, value := range row {
+			tags["Lookup."+table+"."+column] = value
+		}
+	}
+	return tags
+}
+
+// resolvedTags returns every exif field of a file and every computed tag that
+// resolves for it, less the computed tags skipped.
+func resolvedTags(collector *DateIndexCollector, meta *FileMetadata, skip func(name string) bool) map[string]string {
+	tags := map[string]string{}
+	for name, value := range meta.Exif {
+		tags[name] = value
+	}
+	for _, tag := range ComputedTags {
+		if skip(tag.Name) {
+			continue
+		}
+		if value, err := GetTagValue(collector, meta, tag.Name); err == nil {
+			tags[tag.Name] = value
+		}
+	}
+	return tags
+}
+
+// GetScriptTagValue gets a `Script` tag value; a tag the rename script
+// returned for the file.
+func GetScriptTagValue(meta *FileMetadata, tag string, properties ...string) (string, error) {
+	if len(properties) != 1 {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("a script tag takes a single name, e.g. Script.client"))
+	}
+	value, hasValue := meta.ScriptTags[properties[0]]
+	if !hasValue {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag+"."+properties[0], fmt.Errorf("the script didn't return it"))
+	}
+	return value, nil
+}
+
+// scriptBuiltins are the functions available to rename scripts, on top of the
+// starlark built-ins.
+var scriptBuiltins = starlark.StringDict{
+	"number": starlark.NewBuiltin("number", func(_ *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var text string
+		if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 1, &text); err != nil {
+			return nil, err
+		}
+		value, err := ParseRational(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", builtin.Name(), err)
+		}
+		return starlark.Float(value), nil
+	}),
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func loadTestScript(assert *assert.Assertions, dir, source string) (*Script, error) {
+	path := filepath.Join(dir, "rename.star")
+	assert.Nil(ioutil.WriteFile(path, []byte(source), 0644))
+	return LoadScript(path)
+}
+
+func TestScriptRun(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	script, err := loadTestScript(assert, dir, `
+def rename(tags):
+    if tags.get("Make") == "named":
+        return "renamed.jpg"
+    if tags.get("Make") == "none":
+        return None
+    if tags.get("Make") == "list":
+        return []
+    if tags.get("Make") == "fail":
+        fail("no make")
+    focal = number(tags["FocalLength"])
+    return {"lens": "prime" if "-" not in tags["LensModel"] else "zoom", "focal": int(focal), "none": None}
+`)
+	assert.Nil(err)
+
+	result, err := script.Run("a.jpg", map[string]string{"Make": "named"})
+	assert.Nil(err)
+	assert.Equal("renamed.jpg", result.Name)
+
+	result, err = script.Run("a.jpg", map[string]string{"Make": "none"})
+	assert.Nil(err)
+	assert.Empty(result.Name)
+	assert.Empty(result.Tags)
+
+	result, err = script.Run("a.jpg", map[string]string{"FocalLength": "50/1", "LensModel": "EF50mm f/1.8"})
+	assert.Nil(err)
+	assert.Equal(map[string]string{"lens": "prime", "focal": "50"}, result.Tags)
+
+	_, err = script.Run("a.jpg", map[string]string{"Make": "list"})
+	assert.NotNil(err)
+	assert.Equal(ErrorKindScript, ErrorKindOf(err))
+	assert.True(strings.Contains(err.Error(), "not list"))
+
+	_, err = script.Run("a.jpg", map[string]string{"Make": "fail"})
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "no make"))
+
+	_, err = script.Run("a.jpg", map[string]string{"FocalLength": "abc", "LensModel": ""})
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "number"))
+}
+
+func TestScriptTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	script, err := loadTestScript(assert, dir, `
+def rename(tags):
+    for i in range(1<<62):
+        pass
+`)
+	assert.Nil(err)
+	script.Timeout = 10 * time.Millisecond
+
+	// Run only returns once the call is cancelled.
+	started := time.Now()
+	_, err = script.Run("a.jpg", nil)
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "timed out"))
+	assert.True(time.Since(started) < 5*time.Second)
+}
+
+func TestLoadScriptErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	_, err = loadTestScript(assert, dir, "def name(tags):\n    return None\n")
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "rename(tags)"))
+
+	_, err = loadTestScript(assert, dir, "def rename(tags):\n    return open('/etc/passwd')\n")
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "undefined: open"))
+
+	_, err = loadTestScript(assert, dir, "load('other.star', 'x')\ndef rename(tags):\n    return x\n")
+	assert.NotNil(err)
+
+	_, err = loadTestScript(assert, dir, "def rename(tags):\n    while True:\n        pass\n")
+	assert.NotNil(err)
+
+	_, err = LoadScript(filepath.Join(dir, "missing.star"))
+	assert.NotNil(err)
+}
+
+func TestScriptTags(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	meta := templateTestMeta(assert, dir, ExifTags{"Make": "Canon", "DateTimeOriginal": "2016:08:12 14:00:00"})
+	collector := NewDateIndexCollector()
+	collector.Add(meta.CaptureTime)
+	tags := ScriptInputTags(collector, meta)
+	assert.Equal("Canon", tags["Make"])
+	assert.Equal("IMG_0001.JPG", tags["File.Name"])
+	assert.Equal("000001", tags["Index"])
+	_, hasHash := tags["File.Hash"]
+	assert.False(hasHash)
+	_, hasGroup := tags["Group.Id"]
+	assert.False(hasGroup)
+
+	meta.ScriptTags = map[string]string{"client": "acme"}
+	value, err := GetTagValue(collector, meta, "Script.client")
+	assert.Nil(err)
+	assert.Equal("acme", value)
+	_, err = GetTagValue(collector, meta, "Script.other")
+	assert.True(IsMissingTagError(err))
+
+	assert.Empty(lintPatternSource(t, "{Script.client}_{Index}"))
+	assert.Len(lintPatternSource(t, "{Script}_{Index}"), 1)
+}
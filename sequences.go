@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	// DefaultSequenceGap is the default maximum time between shots in a sequence.
+	DefaultSequenceGap = 2 * time.Second
+
+	// burstMaxInterval is the longest average interval between the shots of a burst.
+	burstMaxInterval = 500 * time.Millisecond
+)
+
+// SequenceKind is the kind of a sequence of shots.
+type SequenceKind string
+
+// sequence kinds
+const (
+	// SequenceKindSingle is a shot that is not part of a sequence.
+	SequenceKindSingle SequenceKind = "single"
+
+	// SequenceKindBurst is a rapid sequence of shots.
+	SequenceKindBurst SequenceKind = "burst"
+
+	// SequenceKindBracket is a sequence of shots at different exposure biases.
+	SequenceKindBracket SequenceKind = "bracket"
+
+	// SequenceKindPanorama is a slower sequence of shots with locked exposure.
+	SequenceKindPanorama SequenceKind = "panorama"
+)
+
+// exposureFields are the fields that are the same for every shot of a
+// panorama shot with locked exposure.
+var exposureFields = []exif.FieldName{
+	exif.ExposureTime,
+	exif.FNumber,
+	exif.ISOSpeedRatings,
+	exif.FocalLength,
+}
+
+// Sequence is a set of shots from the same camera taken in quick succession,
+// in capture order.
+type Sequence struct {
+	ID    int
+	Kind  SequenceKind
+	Files []*FileMetadata
+}
+
+// DetectSequences groups files from the same camera whose capture times are at
+// most the gap apart; capture times include sub-seconds where there are any.
+// Every file is assigned a sequence, and sequences are numbered in order of
+// their first shot.
+//
+// Maker notes aren't decoded, so maker specific burst ids aren't used.
+func DetectSequences(metas []*FileMetadata, maxGap time.Duration) []*Sequence {
+	ordered := make([]*FileMetadata, len(metas))
+	copy(ordered, metas)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		cameraI, cameraJ := cameraKey(ordered[i]), cameraKey(ordered[j])
+		if cameraI != cameraJ {
+			return cameraI < cameraJ
+		}
+		return ordered[i].CaptureTime.Before(ordered[j].CaptureTime)
+	})
+
+	var sequences []*Sequence
+	var current *Sequence
+	var last *FileMetadata
+	for _, meta := range ordered {
+		if current == nil || cameraKey(meta) != cameraKey(last) || meta.CaptureTime.Sub(last.CaptureTime) > maxGap {
+			current = &Sequence{}
+			sequences = append(sequences, current)
+		}
+		current.Files = append(current.Files, meta)
+		last = meta
+	}
+
+	sort.SliceStable(sequences, func(i, j int) bool {
+		return sequences[i].Files[0].CaptureTime.Before(sequences[j].Files[0].CaptureTime)
+	})
+	for index, sequence := range sequences {
+		sequence.ID = index + 1
+		sequence.Kind = ClassifySequence(sequence.Files)
+		for fileIndex, meta := range sequence.Files {
+			meta.Sequence = sequence
+			meta.SequenceIndex = fileIndex + 1
+		}
+	}
+	return sequences
+}
+
+// ClassifySequence returns the kind of a sequence of shots in capture order.
+// Shots at more than one exposure bias are a bracket; otherwise shots closer
+// together than a burst interval on average are a burst, and slower shots with
+// identical exposure settings are a panorama.
+func ClassifySequence(files []*FileMetadata) SequenceKind {
+	if len(files) < 2 {
+		return SequenceKindSingle
+	}
+
+	biases := map[float64]bool{}
+	for _, meta := range files {
+		if bias, err := meta.Exif.GetFloat(exif.ExposureBiasValue); err == nil {
+			biases[bias] = true
+		}
+	}
+	if len(biases) > 1 {
+		return SequenceKindBracket
+	}
+
+	elapsed := files[len(files)-1].CaptureTime.Sub(files[0].CaptureTime)
+	if elapsed/time.Duration(len(files)-1) <= burstMaxInterval {
+		return SequenceKindBurst
+	}
+	if hasLockedExposure(files) {
+		return SequenceKindPanorama
+	}
+	return SequenceKindBurst
+}
+
+func hasLockedExposure(files []*FileMetadata) bool {
+	for _, field := range exposureFields {
+		first, err := files[0].Exif.Get(field)
+		if err != nil {
+			return false
+		}
+		for _, meta := range files[1:] {
+			if value, err := meta.Exif.Get(field); err != nil || value != first {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cameraKey identifies the camera that took a shot, by its make, model and,
+// if the file has one, body serial number, so two bodies of the same model
+// are told apart.
+func cameraKey(meta *FileMetadata) string {
+	cameraMake, _ := meta.Exif.Get(exif.Make)
+	model, _ := meta.Exif.Get(exif.Model)
+	serial, _ := meta.Exif.Get(BodySerialNumber)
+	return cameraMake + "\x00" + model + "\x00" + serial
+}
+
+// GetSequenceTagValue gets a `Sequence.*` tag value.
+func GetSequenceTagValue(meta *FileMetadata, tag string, properties ...string) (string, error) {
+	if meta.Sequence == nil {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("file is not part of a sequence"))
+	}
+	if len(properties) > 0 {
+		switch properties[0] {
+		case "Id":
+			return fmt.Sprintf("%06d", meta.Sequence.ID), nil
+		case "Index":
+			return fmt.Sprintf("%02d", meta.SequenceIndex), nil
+		case "Kind":
+			return string(meta.Sequence.Kind), nil
+		case "Size":
+			return strconv.Itoa(len(meta.Sequence.Files)), nil
+		}
+	}
+	return "", NewFileError(ErrorKindMissingTag, meta.Path, tag, fmt.Errorf("unknown property %q", strings.Join(properties, ".")))
+}
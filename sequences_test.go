@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func sequenceMeta(model string, captureTime time.Time, subSec, bias string) *FileMetadata {
+	tags := ExifTags{
+		"DateTimeOriginal": captureTime.Format(timestampFormat),
+		"Make":             "Canon",
+		"Model":            model,
+		"ExposureTime":     "1/1000",
+		"FNumber":          "28/10",
+		"ISOSpeedRatings":  "400",
+		"FocalLength":      "50/1",
+	}
+	if len(subSec) > 0 {
+		tags["SubSecTimeOriginal"] = subSec
+	}
+	if len(bias) > 0 {
+		tags["ExposureBiasValue"] = bias
+	}
+	meta := &FileMetadata{Exif: tags}
+	meta.SetExif(tags, nil)
+	return meta
+}
+
+func TestDetectSequences(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Date(2016, 8, 12, 14, 0, 0, 0, time.UTC)
+	metas := []*FileMetadata{
+		sequenceMeta("5D", start, "50", ""),
+		sequenceMeta("5D", start, "05", ""),
+		sequenceMeta("5D", start.Add(time.Second), "", ""),
+		sequenceMeta("7D", start, "20", ""),
+		sequenceMeta("5D", start.Add(time.Minute), "", "-2/3"),
+		sequenceMeta("5D", start.Add(time.Minute+time.Second), "", "0/1"),
+		sequenceMeta("5D", start.Add(time.Minute+2*time.Second), "", "2/3"),
+		sequenceMeta("5D", start.Add(time.Hour), "", ""),
+		sequenceMeta("5D", start.Add(time.Hour+time.Second+500*time.Millisecond), "", ""),
+		sequenceMeta("5D", start.Add(2*time.Hour), "", ""),
+	}
+
+	sequences := DetectSequences(metas, DefaultSequenceGap)
+	assert.Len(sequences, 5)
+
+	// sub-seconds order shots within the same second.
+	assert.Equal(1, metas[0].Sequence.ID)
+	assert.Equal(2, metas[0].SequenceIndex)
+	assert.Equal(1, metas[1].SequenceIndex)
+	assert.Equal(3, metas[2].SequenceIndex)
+	assert.Equal(SequenceKindBurst, metas[0].Sequence.Kind)
+
+	assert.Equal(2, metas[3].Sequence.ID)
+	assert.Equal(SequenceKindSingle, metas[3].Sequence.Kind)
+
+	assert.Equal(SequenceKindBracket, metas[4].Sequence.Kind)
+	assert.Len(metas[4].Sequence.Files, 3)
+
+	assert.Equal(SequenceKindPanorama, metas[7].Sequence.Kind)
+	assert.Equal(metas[7].Sequence, metas[8].Sequence)
+	assert.Equal(5, metas[9].Sequence.ID)
+
+	value, err := GetSequenceTagValue(metas[5], "Sequence", "Id")
+	assert.Nil(err)
+	assert.Equal("000003", value)
+	value, err = GetSequenceTagValue(metas[5], "Sequence", "Kind")
+	assert.Nil(err)
+	assert.Equal("bracket", value)
+}
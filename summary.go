@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// exit codes
+const (
+	// ExitCodeOK is returned when every file was processed.
+	ExitCodeOK = 0
+
+	// ExitCodeError is returned when the run was aborted.
+	ExitCodeError = 1
+
+	// ExitCodePartial is returned when the run completed but some files were skipped.
+	ExitCodePartial = 2
+)
+
+// NewRunSummary returns a new run summary.
+func NewRunSummary() *RunSummary {
+	return &RunSummary{}
+}
+
+// RunSummary collects the outcome of a run.
+type RunSummary struct {
+	Processed  int
+	Unchanged  int
+	Duplicates int
+	Skipped    []*FileError
+	Fallbacks  []*FileError
+	// Renamed is the new path of each file that was renamed.
+	Renamed []string
+}
+
+// Success records a file that was processed.
+func (rs *RunSummary) Success() {
+	rs.Processed++
+}
+
+// Rename records a file that was renamed to a given path.
+func (rs *RunSummary) Rename(target string) {
+	rs.Processed++
+	rs.Renamed = append(rs.Renamed, target)
+}
+
+// AlreadyNamed records a file that was already named correctly.
+func (rs *RunSummary) AlreadyNamed() {
+	rs.Unchanged++
+}
+
+// Duplicate records a file that was a duplicate of another file.
+func (rs *RunSummary) Duplicate() {
+	rs.Duplicates++
+}
+
+// Skip records a file that was left untouched.
+func (rs *RunSummary) Skip(err *FileError) {
+	rs.Skipped = append(rs.Skipped, err)
+}
+
+// Fallback records a value that was substituted for an error.
+func (rs *RunSummary) Fallback(err *FileError) {
+	rs.Fallbacks = append(rs.Fallbacks, err)
+}
+
+// ExitCode returns the process exit code for the summary.
+func (rs *RunSummary) ExitCode() int {
+	if len(rs.Skipped) > 0 {
+		return ExitCodePartial
+	}
+	return ExitCodeOK
+}
+
+// WriteTo writes the summary to a given writer.
+func (rs *RunSummary) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	write := func(format string, args ...interface{}) error {
+		n, err := fmt.Fprintf(w, format, args...)
+		total += int64(n)
+		return err
+	}
+
+	if err := write("%d processed, %d unchanged, %d duplicates, %d skipped, %d fallbacks\n", rs.Processed, rs.Unchanged, rs.Duplicates, len(rs.Skipped), len(rs.Fallbacks)); err != nil {
+		return total, err
+	}
+	for _, skipped := range rs.Skipped {
+		if err := write("skipped: %v\n", skipped); err != nil {
+			return total, err
+		}
+	}
+	for _, fallback := range rs.Fallbacks {
+		if err := write("fallback: %v\n", fallback); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
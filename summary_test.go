@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestRunSummary(t *testing.T) {
+	assert := assert.New(t)
+
+	summary := NewRunSummary()
+	summary.Success()
+	summary.AlreadyNamed()
+	assert.Equal(ExitCodeOK, summary.ExitCode())
+
+	summary.Fallback(NewFileError(ErrorKindMissingTag, "a.jpg", "Make", fmt.Errorf("test")))
+	assert.Equal(ExitCodeOK, summary.ExitCode())
+
+	summary.Skip(NewFileError(ErrorKindNoExif, "b.jpg", "", fmt.Errorf("test")))
+	assert.Equal(ExitCodePartial, summary.ExitCode())
+
+	buffer := bytes.NewBuffer(nil)
+	_, err := summary.WriteTo(buffer)
+	assert.Nil(err)
+	assert.Equal("1 processed, 1 unchanged, 0 duplicates, 1 skipped, 1 fallbacks\nskipped: b.jpg: no exif data: test\nfallback: a.jpg: missing tag (Make): test\n", buffer.String())
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ExifFieldNames are the exif fields that can be used as tags; the ifd
+// pointers and the maker note are left out as they aren't useful in names.
+var ExifFieldNames = []exif.FieldName{
+	exif.ImageWidth, exif.ImageLength, exif.BitsPerSample, exif.Compression, exif.PhotometricInterpretation,
+	exif.Orientation, exif.SamplesPerPixel, exif.PlanarConfiguration, exif.YCbCrSubSampling, exif.YCbCrPositioning,
+	exif.XResolution, exif.YResolution, exif.ResolutionUnit, exif.DateTime, exif.ImageDescription,
+	exif.Make, exif.Model, exif.Software, exif.Artist, exif.Copyright,
+	exif.ExifVersion, exif.FlashpixVersion, exif.ColorSpace, exif.ComponentsConfiguration, exif.CompressedBitsPerPixel,
+	exif.PixelXDimension, exif.PixelYDimension, exif.UserComment, exif.RelatedSoundFile, exif.DateTimeOriginal,
+	exif.DateTimeDigitized, exif.SubSecTime, exif.SubSecTimeOriginal, exif.SubSecTimeDigitized, exif.ImageUniqueID,
+	exif.ExposureTime, exif.FNumber, exif.ExposureProgram, exif.SpectralSensitivity, exif.ISOSpeedRatings,
+	exif.OECF, exif.ShutterSpeedValue, exif.ApertureValue, exif.BrightnessValue, exif.ExposureBiasValue,
+	exif.MaxApertureValue, exif.SubjectDistance, exif.MeteringMode, exif.LightSource, exif.Flash,
+	exif.FocalLength, exif.SubjectArea, exif.FlashEnergy, exif.SpatialFrequencyResponse, exif.FocalPlaneXResolution,
+	exif.FocalPlaneYResolution, exif.FocalPlaneResolutionUnit, exif.SubjectLocation, exif.ExposureIndex, exif.SensingMethod,
+	exif.FileSource, exif.SceneType, exif.CFAPattern, exif.CustomRendered, exif.ExposureMode,
+	exif.WhiteBalance, exif.DigitalZoomRatio, exif.FocalLengthIn35mmFilm, exif.SceneCaptureType, exif.GainControl,
+	exif.Contrast, exif.Saturation, exif.Sharpness, exif.DeviceSettingDescription, exif.SubjectDistanceRange,
+	exif.LensMake, exif.LensModel, BodySerialNumber, exif.ThumbJPEGInterchangeFormat, exif.ThumbJPEGInterchangeFormatLength, exif.GPSVersionID,
+	exif.GPSLatitudeRef, exif.GPSLatitude, exif.GPSLongitudeRef, exif.GPSLongitude, exif.GPSAltitudeRef,
+	exif.GPSAltitude, exif.GPSTimeStamp, exif.GPSSatelites, exif.GPSStatus, exif.GPSMeasureMode,
+	exif.GPSDOP, exif.GPSSpeedRef, exif.GPSSpeed, exif.GPSTrackRef, exif.GPSTrack,
+	exif.GPSImgDirectionRef, exif.GPSImgDirection, exif.GPSMapDatum, exif.GPSDestLatitudeRef, exif.GPSDestLatitude,
+	exif.GPSDestLongitudeRef, exif.GPSDestLongitude, exif.GPSDestBearingRef, exif.GPSDestBearing, exif.GPSDestDistanceRef,
+	exif.GPSDestDistance, exif.GPSProcessingMethod, exif.GPSAreaInformation, exif.GPSDateStamp, exif.GPSDifferential,
+	exif.InteroperabilityIndex,
+}
+
+// TimestampProperties are the properties of date time tags.
+var TimestampProperties = []string{
+	"Year", "Month", "Day", "Hour", "Minute", "Second", "Millisecond", "Microsecond", "Nanosecond",
+	"Unix", "Weekday", "Offset", "Week", "WeekYear",
+}
+
+// TagDescription describes a tag that isn't read from exif data. Timestamp
+// tags take the date time properties.
+type TagDescription struct {
+	Name        string
+	Description string
+	Timestamp   bool
+}
+
+// ComputedTags are the tags that aren't read from exif data.
+var ComputedTags = []TagDescription{
+	{Name: "Index", Description: "The index of the file in the run; add scope=camera, directory, hour, week, event or a quoted pattern to count per scope."},
+	{Name: "File.Index", Description: "The position of the file in this run, counting the files named so far."},
+	{Name: "File.IndexByCaptureYear", Description: "The index of the file by capture year."},
+	{Name: "File.IndexByCaptureMonth", Description: "The index of the file by capture year and month."},
+	{Name: "File.IndexByCaptureDate", Description: "The index of the file by capture date."},
+	{Name: "File.Name", Description: "The original file name."},
+	{Name: "File.Extension", Description: "The original file extension."},
+	{Name: "File.Directory", Description: "The name of the directory the file is in."},
+	{Name: "File.Size", Description: "The size of the file in bytes."},
+	{Name: "File.ModTime", Description: "The modification time of the file.", Timestamp: true},
+	{Name: "File.Hash", Description: "The sha-256 of the file contents."},
+	{Name: "File.Hash.Short", Description: "The first 8 characters of the sha-256 of the file contents."},
+	{Name: "Group.Id", Description: "The similar image group number; requires --similar."},
+	{Name: "Group.Index", Description: "The index of the file within its similar image group."},
+	{Name: "Group.Size", Description: "The number of files in the similar image group."},
+	{Name: "Group.Series", Description: "`-` and the group index if the group has more than one file."},
+	{Name: "Sequence.Id", Description: "The sequence number."},
+	{Name: "Sequence.Index", Description: "The index of the shot within its sequence."},
+	{Name: "Sequence.Size", Description: "The number of shots in the sequence."},
+	{Name: "Sequence.Kind", Description: "One of bracket, burst, panorama or single."},
+	{Name: "Event.Index", Description: "The event number."},
+	{Name: "Event.Index.Within", Description: "The index of the shot within its event."},
+	{Name: "Event.Start", Description: "The capture time of the first shot of the event.", Timestamp: true},
+	{Name: "Event.End", Description: "The capture time of the last shot of the event.", Timestamp: true},
+	{Name: "Event.Size", Description: "The number of shots in the event."},
+	{Name: "Event.Name", Description: "The name of the event from the --events file."},
+}
+
+// WriteTagNames writes every tag name that can be used in an output pattern.
+func WriteTagNames(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, tag := range ComputedTags {
+		name := tag.Name
+		if tag.Timestamp {
+			name += ".*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, tag.Description)
+	}
+	fmt.Fprintf(tw, "%s\t%s\n", "Script.*", "A tag returned by the --script rename function.")
+	fmt.Fprintf(tw, "%s\t%s\n", "Ext.*", "A tag returned by the --plugin executable.")
+	fmt.Fprintf(tw, "%s\t%s\n", "Lookup.*.*", "A column of the row of a --lookup table that matches the file, as Lookup.table.column.")
+	for _, field := range ExifFieldNames {
+		if _, isTimestamp := timestampFields[field]; isTimestamp {
+			fmt.Fprintf(tw, "%s.*\t%s\n", field, "An exif date time field.")
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", field, "An exif field.")
+	}
+	fmt.Fprintf(tw, "\nDate time properties (.*): %s\n", strings.Join(TimestampProperties, ", "))
+	return tw.Flush()
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestWriteTagNames(t *testing.T) {
+	assert := assert.New(t)
+
+	var buffer bytes.Buffer
+	assert.Nil(WriteTagNames(&buffer))
+	output := buffer.String()
+	assert.True(strings.Contains(output, "File.ModTime.*"))
+	assert.True(strings.Contains(output, "DateTimeOriginal.*"))
+	assert.True(strings.Contains(output, "\nMake "))
+	assert.False(strings.Contains(output, "MakerNote"))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// TemplateData is the data an output template is executed with.
+type TemplateData struct {
+	// Exif is every exif field of the file, as rendered by the `{Tag}` pattern.
+	Exif map[string]string
+	File TemplateFile
+	// Capture is the capture time of the file.
+	Capture time.Time
+	// Index is the index of the file in the run, as `{Index}`.
+	Index int
+	// GPS is the location of the file, or nil if it has no gps coordinates.
+	GPS *TemplateGPS
+	// Script is the tags the rename script returned for the file.
+	Script map[string]string
+	// Ext is the tags the tag plugin returned for the file.
+	Ext map[string]string
+	// Lookup is the row of each lookup table that matched the file, by table
+	// and column.
+	Lookup map[string]map[string]string
+}
+
+// TemplateFile is the file an output template is executed for.
+type TemplateFile struct {
+	Name                string
+	Extension           string
+	Directory           string
+	Size                int64
+	ModTime             time.Time
+	Index               int
+	IndexByCaptureYear  int
+	IndexByCaptureMonth int
+	IndexByCaptureDate  int
+
+	meta *FileMetadata
+}
+
+// Hash returns the sha-256 of the file contents; the file is only read if a
+// template uses it.
+func (tf TemplateFile) Hash() (string, error) {
+	return tf.meta.EnsureHash()
+}
+
+// TemplateGPS is the location of a file.
+type TemplateGPS struct {
+	// Latitude and Longitude are in degrees, negative for south and west.
+	Latitude  float64
+	Longitude float64
+	// Altitude is in meters, negative below sea level, and 0 if it wasn't
+	// recorded.
+	Altitude float64
+}
+
+// TemplateFuncs are the functions available to output templates.
+var TemplateFuncs = template.FuncMap{
+	"pad":      templatePad,
+	"lower":    strings.ToLower,
+	"slug":     Slug,
+	"date":     templateDate,
+	"default":  templateDefault,
+	"truncate": templateTruncate,
+}
+
+// ParseOutputTemplate parses a Go text/template output format.
+func ParseOutputTemplate(source string) (*template.Template, error) {
+	tmpl, err := template.New("output").Funcs(TemplateFuncs).Option("missingkey=zero").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("template: %v", strings.TrimPrefix(err.Error(), "template: "))
+	}
+	return tmpl, nil
+}
+
+// NewTemplateData returns the data for a file once it has been counted by the
+// collector.
+func NewTemplateData(collector *DateIndexCollector, meta *FileMetadata) TemplateData {
+	// values are rendered by their tag, so timestamps are formatted as `{DateTime}` is.
+	exifValues := map[string]string{}
+	for name, value := range meta.Exif {
+		if rendered, err := GetExifTagValue(meta.Exif, name); err == nil {
+			value = rendered
+		}
+		exifValues[name] = value
+	}
+	data := TemplateData{
+		Exif:    exifValues,
+		Capture: meta.CaptureTime,
+		Index:   collector.Len(),
+		Script:  meta.ScriptTags,
+		Ext:     meta.ExtTags,
+		Lookup:  LookupRows(meta),
+		File: TemplateFile{
+			Name:                filepath.Base(meta.Path),
+			Extension:           strings.TrimPrefix(filepath.Ext(meta.Path), "."),
+			Directory:           filepath.Base(filepath.Dir(meta.Path)),
+			Index:               collector.Len(),
+			IndexByCaptureYear:  collector.GetIndexByYear(meta.CaptureTime),
+			IndexByCaptureMonth: collector.GetIndexByMonth(meta.CaptureTime),
+			IndexByCaptureDate:  collector.GetIndexByDay(meta.CaptureTime),
+			meta:                meta,
+		},
+	}
+	if meta.Info != nil {
+		data.File.Size = meta.Info.Size()
+		data.File.ModTime = meta.Info.ModTime()
+	}
+	if lat, long, err := meta.Exif.LatLong(); err == nil {
+		data.GPS = &TemplateGPS{Latitude: lat, Longitude: long}
+		if altitude, err := meta.Exif.GetFloat(exif.GPSAltitude); err == nil {
+			if ref, _ := meta.Exif.Get(exif.GPSAltitudeRef); strings.TrimSpace(ref) == "1" {
+				altitude = -altitude
+			}
+			data.GPS.Altitude = altitude
+		}
+	}
+	return data
+}
+
+// RenderTemplate executes an output template for a file.
+func RenderTemplate(tmpl *template.Template, collector *DateIndexCollector, meta *FileMetadata) (string, error) {
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, NewTemplateData(collector, meta)); err != nil {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, "template", err)
+	}
+	if len(strings.TrimSpace(rendered.String())) == 0 {
+		return "", NewFileError(ErrorKindMissingTag, meta.Path, "template", fmt.Errorf("the template rendered an empty name"))
+	}
+	return rendered.String(), nil
+}
+
+// Slug returns text in lower case with every run of characters other than
+// letters and digits replaced by a single `-`.
+func Slug(text string) string {
+	var slug strings.Builder
+	var pendingDash bool
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingDash && slug.Len() > 0 {
+				slug.WriteRune('-')
+			}
+			pendingDash = false
+			slug.WriteRune(r)
+			continue
+		}
+		pendingDash = true
+	}
+	return slug.String()
+}
+
+// templatePad pads a value with leading zeros to a width, e.g.
+// `{{.Index | pad 4}}`.
+func templatePad(width int, value interface{}) string {
+	text := fmt.Sprint(value)
+	if padding := width - len([]rune(text)); padding > 0 {
+		return strings.Repeat("0", padding) + text
+	}
+	return text
+}
+
+// templateDate formats a time with a Go layout, e.g.
+// `{{date "2006-01-02" .Capture}}`.
+func templateDate(layout string, timestamp time.Time) string {
+	return timestamp.Format(layout)
+}
+
+// templateDefault returns a fallback for an empty value, e.g.
+// `{{.Exif.Model | default "unknown"}}`.
+func templateDefault(fallback, value interface{}) interface{} {
+	if value == nil {
+		return fallback
+	}
+	if reflected := reflect.ValueOf(value); reflected.IsZero() {
+		return fallback
+	}
+	return value
+}
+
+// templateTruncate returns at most the first length characters of text, e.g.
+// `{{.File.Hash | truncate 8}}`.
+func templateTruncate(length int, text string) string {
+	if runes := []rune(text); len(runes) > length && length >= 0 {
+		return string(runes[:length])
+	}
+	return text
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func templateTestMeta(assert *assert.Assertions, dir string, exifTags ExifTags) *FileMetadata {
+	imagePath := filepath.Join(dir, "IMG_0001.JPG")
+	assert.Nil(ioutil.WriteFile(imagePath, []byte("image"), 0644))
+	info, err := os.Stat(imagePath)
+	assert.Nil(err)
+	captureTime, err := GetExifCaptureTime(exifTags)
+	assert.Nil(err)
+	return &FileMetadata{Path: imagePath, Info: info, Exif: exifTags, CaptureTime: captureTime}
+}
+
+func renderTestTemplate(assert *assert.Assertions, source string, meta *FileMetadata) (string, error) {
+	tmpl, err := ParseOutputTemplate(source)
+	assert.Nil(err)
+	collector := NewDateIndexCollector()
+	collector.Add(meta.CaptureTime)
+	return RenderTemplate(tmpl, collector, meta)
+}
+
+func TestRenderTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	meta := templateTestMeta(assert, dir, ExifTags{
+		"Model":            "EOS 5D Mark III",
+		"DateTimeOriginal": "2016:08:12 14:00:00",
+		"GPSLatitude":      `["40/1","30/1","0/1"]`,
+		"GPSLatitudeRef":   "S",
+		"GPSLongitude":     `["3/1","0/1","0/1"]`,
+		"GPSLongitudeRef":  "E",
+		"GPSAltitude":      "120/1",
+		"GPSAltitudeRef":   "1",
+	})
+
+	rendered, err := renderTestTemplate(assert, `{{date "2006/01-02" .Capture}}_{{.Exif.Model | slug}}_{{.Index | pad 4}}_{{.File.Hash | truncate 8}}.{{.File.Extension | lower}}`, meta)
+	assert.Nil(err)
+	assert.Equal("2016/08-12_eos-5d-mark-iii_0001_6105d6cc.jpg", rendered)
+
+	rendered, err = renderTestTemplate(assert, `{{.Exif.Artist | default "unknown"}}_{{.File.IndexByCaptureDate}}{{with .GPS}}_{{printf "%.1f,%.1f,%.0f" .Latitude .Longitude .Altitude}}{{end}}`, meta)
+	assert.Nil(err)
+	assert.Equal("unknown_1_-40.5,3.0,-120", rendered)
+
+	rendered, err = renderTestTemplate(assert, `{{.Exif.DateTimeOriginal}}`, meta)
+	assert.Nil(err)
+	assert.Equal("2016-08-12T14:00:00Z", rendered)
+
+	_, err = renderTestTemplate(assert, "{{.Missing}}", meta)
+	assert.NotNil(err)
+	_, err = renderTestTemplate(assert, "{{if .GPS}}{{end}} ", meta)
+	assert.NotNil(err)
+	assert.True(strings.Contains(err.Error(), "empty name"))
+
+	_, err = ParseOutputTemplate("{{.Exif.Model")
+	assert.NotNil(err)
+	_, err = ParseOutputTemplate("{{unknown .Exif.Model}}")
+	assert.NotNil(err)
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("a-b-c-d", Slug("  A.b--C  d! "))
+	assert.Equal("0042", templatePad(4, 42))
+	assert.Equal("12345", templatePad(4, 12345))
+	assert.Equal("fallback", templateDefault("fallback", ""))
+	assert.Equal("fallback", templateDefault("fallback", time.Time{}))
+	assert.Equal(0, templateDefault(0, nil))
+	assert.Equal("value", templateDefault("fallback", "value"))
+	assert.Equal("ab", templateTruncate(2, "abc"))
+	assert.Equal("ab", templateTruncate(5, "ab"))
+	assert.Equal("2016", templateDate("2006", time.Date(2016, 8, 12, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestApplyPatternTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	options := renameTestOptions("")
+	options.Template, err = ParseOutputTemplate(dir + `/renamed_{{.Index | pad 2}}.{{.File.Extension}}`)
+	assert.Nil(err)
+	options.Plan = &RenamePlan{}
+	summary, err := ApplyPattern(renameTestFiles(assert, dir), nil, options)
+	assert.Nil(err)
+	assert.Equal(2, summary.Processed)
+	assert.Len(options.Plan.Renames, 2)
+	assert.Equal(filepath.Join(dir, "renamed_01.txt"), options.Plan.Renames[0].To)
+	assert.Equal(filepath.Join(dir, "renamed_02.txt"), options.Plan.Renames[1].To)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// TagMismatch is a tag whose value in a file name disagrees with the value
+// computed from the file.
+type TagMismatch struct {
+	Tag    string
+	Name   string
+	Actual string
+	Err    error
+}
+
+// String returns a description of the mismatch.
+func (tm TagMismatch) String() string {
+	if tm.Err != nil {
+		return fmt.Sprintf("%s is %q in the name but cannot be read: %v", tm.Tag, tm.Name, tm.Err)
+	}
+	return fmt.Sprintf("%s is %q in the name but %q in the file", tm.Tag, tm.Name, tm.Actual)
+}
+
+// VerifyResult is the outcome of verifying a file name against the output
+// pattern.
+type VerifyResult struct {
+	Path       string
+	Matched    bool
+	Values     map[string]string
+	Mismatches []TagMismatch
+}
+
+// OK returns if the file name matches the pattern and agrees with the file.
+func (vr VerifyResult) OK() bool {
+	return vr.Matched && len(vr.Mismatches) == 0
+}
+
+// VerifyFile parses a file's name with the output pattern and compares each
+// tag that only depends on the file itself with the value computed from its
+// metadata. Indexes, groups, sequences and events depend on the other files in
+// a run, and script, plugin and lookup tags on the run's options, so they are
+// not compared.
+func VerifyFile(matcher *PatternMatcher, meta *FileMetadata) VerifyResult {
+	result := VerifyResult{Path: meta.Path}
+	values, matches := matcher.MatchPath(meta.Path)
+	if !matches {
+		return result
+	}
+	result.Matched = true
+	result.Values = values
+
+	collector := NewDateIndexCollector()
+	compared := map[string]bool{}
+	for _, tag := range matcher.Tags {
+		if compared[tag] || !IsVerifiableTag(tag) {
+			continue
+		}
+		compared[tag] = true
+
+		actual, err := GetTagValue(collector, meta, tag)
+		if err != nil {
+			result.Mismatches = append(result.Mismatches, TagMismatch{Tag: tag, Name: values[tag], Err: err})
+			continue
+		}
+		if actual != values[tag] {
+			result.Mismatches = append(result.Mismatches, TagMismatch{Tag: tag, Name: values[tag], Actual: actual})
+		}
+	}
+	return result
+}
+
+// IsVerifiableTag returns if a tag's value only depends on the file itself.
+func IsVerifiableTag(tag string) bool {
+	for _, alternative := range SplitOutsideQuotes(tag, '|') {
+		if IsIndexTag(alternative) {
+			return false
+		}
+		tagName, _, err := ParseTagAttributes(alternative)
+		if err != nil {
+			return false
+		}
+		namespace, properties := ParseTagProperties(tagName)
+		switch namespace {
+		case "Group", "Sequence", "Event", "Script", "Ext", "Lookup":
+			return false
+		case "File":
+			// the original name is gone once a file has been renamed.
+			if len(properties) > 0 && properties[0] == "Name" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// VerifyFiles verifies every file against the output pattern, in file order.
+func VerifyFiles(metas []*FileMetadata, pattern string) ([]VerifyResult, error) {
+	matcher, err := NewPatternMatcher(pattern)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]VerifyResult, len(metas))
+	for index, meta := range metas {
+		results[index] = VerifyFile(matcher, meta)
+	}
+	return results, nil
+}
+
+// ReserveConformingFiles returns the files whose names already match the
+// output pattern and agree with their metadata, and seeds the collector with
+// their indexes so the other files are numbered after them.
+func ReserveConformingFiles(collector *DateIndexCollector, metas []*FileMetadata, pattern string) (map[*FileMetadata]bool, error) {
+	results, err := VerifyFiles(metas, pattern)
+	if err != nil {
+		return nil, err
+	}
+	conforming := map[*FileMetadata]bool{}
+	for index, result := range results {
+		if result.OK() {
+			conforming[metas[index]] = true
+			seedIndexesFromFile(collector, metas[index], result.Values)
+		}
+	}
+	return conforming, nil
+}
+
+// WriteVerifyResults writes the files that failed verification to a given
+// writer, returning the number of failures.
+func WriteVerifyResults(w io.Writer, results []VerifyResult) (int, error) {
+	var failed int
+	for _, result := range results {
+		if result.OK() {
+			continue
+		}
+		failed++
+		if !result.Matched {
+			if _, err := fmt.Fprintf(w, "unmatched: %s\n", result.Path); err != nil {
+				return failed, err
+			}
+			continue
+		}
+		for _, mismatch := range result.Mismatches {
+			if _, err := fmt.Fprintf(w, "mismatch: %s: %v\n", result.Path, mismatch); err != nil {
+				return failed, err
+			}
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestVerifyFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename-verify")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	var metas []*FileMetadata
+	for _, name := range []string{"20160812_Canon_000001.jpg", "20160812_Nikon_000002.jpg", "20160813_Canon_000003.jpg", "IMG_0001.jpg"} {
+		filePath := filepath.Join(dir, name)
+		assert.Nil(ioutil.WriteFile(filePath, []byte("not a jpeg"), 0644))
+		info, err := os.Stat(filePath)
+		assert.Nil(err)
+		metas = append(metas, &FileMetadata{
+			Path: filePath,
+			Info: info,
+			Exif: ExifTags{"Make": "Canon", "DateTimeOriginal": "2016:08:12 14:00:00"},
+		})
+	}
+
+	pattern := filepath.ToSlash(dir) + "/{DateTimeOriginal.Year}{DateTimeOriginal.Month}{DateTimeOriginal.Day}_{Make}_{File.Index}.{File.Extension}"
+	results, err := VerifyFiles(metas, pattern)
+	assert.Nil(err)
+	assert.Len(results, 4)
+	assert.True(results[0].OK())
+	assert.False(results[1].OK())
+	assert.Len(results[1].Mismatches, 1)
+	assert.Equal("Make", results[1].Mismatches[0].Tag)
+	assert.Equal("Nikon", results[1].Mismatches[0].Name)
+	assert.Equal("Canon", results[1].Mismatches[0].Actual)
+	assert.Equal("DateTimeOriginal.Day", results[2].Mismatches[0].Tag)
+	assert.False(results[3].Matched)
+
+	buffer := bytes.NewBuffer(nil)
+	failed, err := WriteVerifyResults(buffer, results)
+	assert.Nil(err)
+	assert.Equal(3, failed)
+	assert.True(strings.Contains(buffer.String(), `mismatch: `+metas[1].Path+`: Make is "Nikon" in the name but "Canon" in the file`))
+	assert.True(strings.Contains(buffer.String(), "unmatched: "+metas[3].Path))
+}
+
+func TestIsVerifiableTag(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(IsVerifiableTag("Make"))
+	assert.True(IsVerifiableTag("File.Hash.Short"))
+	assert.False(IsVerifiableTag("File.IndexByCaptureDate"))
+	assert.False(IsVerifiableTag("File.Name"))
+	assert.False(IsVerifiableTag(`Index scope=camera`))
+	assert.False(IsVerifiableTag("Sequence.Id"))
+	assert.False(IsVerifiableTag("Make|Event.Name"))
+	assert.False(IsVerifiableTag("Script.client"))
+	assert.False(IsVerifiableTag("Ext.assetId"))
+	assert.False(IsVerifiableTag("Lookup.schedule.client"))
+}
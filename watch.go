@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is how often `watch` checks for new files by default.
+const DefaultWatchInterval = 2 * time.Second
+
+// NewWatchState returns a new watch state.
+func NewWatchState() *WatchState {
+	return &WatchState{
+		seen: map[string]watchedFile{},
+		done: map[string]bool{},
+	}
+}
+
+// WatchState tracks the files in a watched directory between checks, so a
+// file is only renamed once it has stopped changing, and only once.
+type WatchState struct {
+	seen map[string]watchedFile
+	done map[string]bool
+}
+
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// Ready records the size and modification time of the files currently in the
+// directory, and returns the ones that haven't changed since the last check
+// and haven't been handled yet. A file that is still being copied changes
+// between checks.
+func (ws *WatchState) Ready(files []string) []string {
+	var ready []string
+	seen := map[string]watchedFile{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		current := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		if previous, wasSeen := ws.seen[file]; wasSeen && previous.size == current.size && previous.modTime.Equal(current.modTime) && !ws.done[file] {
+			ready = append(ready, file)
+		}
+		seen[file] = current
+	}
+
+	// a file that is gone and comes back is a new file.
+	for file := range ws.done {
+		if _, isPresent := seen[file]; !isPresent {
+			delete(ws.done, file)
+		}
+	}
+	ws.seen = seen
+	return ready
+}
+
+// Rename renames the files that are ready, and marks them as handled along
+// with their new names, so a renamed file isn't renamed again when it is
+// picked up under its new name. The summary is nil if no file was ready.
+func (ws *WatchState) Rename(files, fileTags []string, options RenameOptions) (*RunSummary, error) {
+	ready := ws.Ready(files)
+	if len(ready) == 0 {
+		return nil, nil
+	}
+	summary, err := ApplyPattern(ready, fileTags, options)
+	ws.Done(ready)
+	for _, target := range summary.Renamed {
+		ws.done[absolutePath(target)] = true
+	}
+	return summary, err
+}
+
+// Done marks files as handled.
+func (ws *WatchState) Done(files []string) {
+	for _, file := range files {
+		ws.done[file] = true
+	}
+}
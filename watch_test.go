@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestWatchStateReady(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg")
+	assert.Nil(ioutil.WriteFile(a, []byte("a"), 0644))
+	assert.Nil(ioutil.WriteFile(b, []byte("b"), 0644))
+
+	state := NewWatchState()
+	assert.Empty(state.Ready([]string{a, b}))
+
+	// b is still being written.
+	assert.Nil(ioutil.WriteFile(b, []byte("bigger"), 0644))
+	assert.Equal([]string{a}, state.Ready([]string{a, b}))
+	state.Done([]string{a})
+	assert.Equal([]string{b}, state.Ready([]string{a, b}))
+	state.Done([]string{b})
+	assert.Empty(state.Ready([]string{a, b}))
+
+	// a file that is gone and comes back is handled again.
+	assert.Empty(state.Ready([]string{b}))
+	assert.Empty(state.Ready([]string{a, b}))
+	assert.Equal([]string{a}, state.Ready([]string{a, b}))
+}
+
+func TestWatchStateRename(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	// names made by a template can't be matched, so only the watch state keeps
+	// renamed files from being renamed again.
+	options := renameTestOptions("")
+	options.Collector = NewDateIndexCollector()
+	options.Template, err = ParseOutputTemplate(dir + `/renamed_{{pad 3 .Index}}.txt`)
+	assert.Nil(err)
+
+	state := NewWatchState()
+	poll := func() *RunSummary {
+		summary, err := state.Rename(renameTestFiles(assert, dir), nil, options)
+		assert.Nil(err)
+		return summary
+	}
+	assert.Nil(poll())
+	summary := poll()
+	assert.NotNil(summary)
+	assert.Equal(2, summary.Processed)
+	assert.Len(summary.Renamed, 2)
+
+	for iteration := 0; iteration < 3; iteration++ {
+		assert.Nil(poll())
+	}
+	files := renameTestFiles(assert, dir)
+	sort.Strings(files)
+	assert.Equal([]string{filepath.Join(dir, "renamed_001.txt"), filepath.Join(dir, "renamed_002.txt")}, files)
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// whereDateFormats are the formats of date literals in a where expression;
+// a date with no time is the whole day.
+var whereDateFormats = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// whereTimestampFormats are the formats tag values are parsed with when they
+// are compared with a date.
+var whereTimestampFormats = []string{
+	time.RFC3339Nano,
+	timestampFormat,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// ParseWhere parses a where expression, e.g.
+// `Make == "Canon" && DateTimeOriginal >= 2016-08-01 && ISOSpeedRatings > 1600`.
+//
+// Operands are tags, as they would be written in an output pattern without
+// braces (or with braces, for tags with attributes or alternatives), quoted
+// strings, numbers, rationals like `1/250`, and dates like `2016-08-01` or
+// `2016-08-01T16:00`. Comparisons are `==`, `!=`, `<`, `<=`, `>`, `>=` and
+// `=~` for a regular expression; they are numeric if one side is a number,
+// by time if one side is a date, and by string otherwise. Comparisons are
+// combined with `&&`, `||`, `!` and parentheses, and a tag on its own is true
+// if the file has it. A comparison with a tag the file doesn't have is false.
+func ParseWhere(source string) (*WhereExpression, error) {
+	tokens, err := lexWhere(source)
+	if err != nil {
+		return nil, err
+	}
+	parser := &whereParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := parser.peek(); next.kind != whereTokenEOF {
+		return nil, fmt.Errorf("where: unexpected %q at column %d", next.text, next.column)
+	}
+	return &WhereExpression{Source: source, root: root}, nil
+}
+
+// WhereExpression is a parsed where expression that selects files by their
+// metadata.
+type WhereExpression struct {
+	Source string
+	root   whereNode
+}
+
+// Matches returns if a file is selected by the expression.
+func (we *WhereExpression) Matches(meta *FileMetadata) bool {
+	return we.root.eval(&whereContext{meta: meta, collector: NewDateIndexCollector()})
+}
+
+// FilterWhere returns the files selected by a where expression, in order; a
+// nil expression selects every file.
+func FilterWhere(metas []*FileMetadata, where *WhereExpression) []*FileMetadata {
+	if where == nil {
+		return metas
+	}
+	var selected []*FileMetadata
+	for _, meta := range metas {
+		if where.Matches(meta) {
+			selected = append(selected, meta)
+		}
+	}
+	return selected
+}
+
+// --------------------------------------------------------------------------------
+// Evaluation
+// --------------------------------------------------------------------------------
+
+type whereContext struct {
+	meta      *FileMetadata
+	collector *DateIndexCollector
+}
+
+type whereNode interface {
+	eval(context *whereContext) bool
+}
+
+type whereAnd struct{ left, right whereNode }
+
+func (wa whereAnd) eval(context *whereContext) bool {
+	return wa.left.eval(context) && wa.right.eval(context)
+}
+
+type whereOr struct{ left, right whereNode }
+
+func (wo whereOr) eval(context *whereContext) bool {
+	return wo.left.eval(context) || wo.right.eval(context)
+}
+
+type whereNot struct{ operand whereNode }
+
+func (wn whereNot) eval(context *whereContext) bool {
+	return !wn.operand.eval(context)
+}
+
+// whereHasTag is a tag on its own, which is true if the file has it.
+type whereHasTag struct{ tag string }
+
+func (wh whereHasTag) eval(context *whereContext) bool {
+	value, err := GetTagValue(context.collector, context.meta, wh.tag)
+	return err == nil && len(value) > 0
+}
+
+// whereOperand is a tag or a literal.
+type whereOperand struct {
+	tag     string
+	literal string
+	kind    whereTokenKind
+	format  string
+}
+
+// value returns the string value of the operand for a file.
+func (wo whereOperand) value(context *whereContext) (string, bool) {
+	if wo.kind != whereTokenTag {
+		return wo.literal, true
+	}
+	value, err := GetTagValue(context.collector, context.meta, wo.tag)
+	return value, err == nil
+}
+
+type whereComparison struct {
+	operator    string
+	left, right whereOperand
+	regex       *regexp.Regexp
+}
+
+func (wc whereComparison) eval(context *whereContext) bool {
+	left, hasLeft := wc.left.value(context)
+	right, hasRight := wc.right.value(context)
+	if !hasLeft || !hasRight {
+		return false
+	}
+
+	switch {
+	case wc.regex != nil:
+		return wc.regex.MatchString(left)
+	case wc.left.kind == whereTokenDate:
+		return wc.compareDate(wc.left, right, true)
+	case wc.right.kind == whereTokenDate:
+		return wc.compareDate(wc.right, left, false)
+	case wc.left.kind == whereTokenNumber || wc.right.kind == whereTokenNumber:
+		leftNumber, leftErr := ParseRational(left)
+		rightNumber, rightErr := ParseRational(right)
+		if leftErr != nil || rightErr != nil {
+			return false
+		}
+		return compareWhere(wc.operator, compareFloats(leftNumber, rightNumber))
+	}
+	leftNumber, leftErr := ParseRational(left)
+	rightNumber, rightErr := ParseRational(right)
+	if leftErr == nil && rightErr == nil {
+		return compareWhere(wc.operator, compareFloats(leftNumber, rightNumber))
+	}
+	return compareWhere(wc.operator, strings.Compare(left, right))
+}
+
+// compareDate compares a tag value with a date literal. The literal covers
+// the range up to the next date of its precision, so `== 2016-08-12` is any
+// time that day and `> 2016-08-12` is from the next day on.
+func (wc whereComparison) compareDate(date whereOperand, value string, dateIsLeft bool) bool {
+	timestamp, err := parseWhereTimestamp(value)
+	if err != nil {
+		return false
+	}
+	start, err := time.ParseInLocation(date.format, date.literal, timestamp.Location())
+	if err != nil {
+		return false
+	}
+	end := start.Add(whereDatePrecision(date.format))
+
+	var comparison int
+	switch {
+	case timestamp.Before(start):
+		comparison = -1
+	case timestamp.Before(end):
+		comparison = 0
+	default:
+		comparison = 1
+	}
+	if dateIsLeft {
+		comparison = -comparison
+	}
+	return compareWhere(wc.operator, comparison)
+}
+
+func whereDatePrecision(format string) time.Duration {
+	switch format {
+	case "2006-01-02":
+		return 24 * time.Hour
+	case "2006-01-02T15:04":
+		return time.Minute
+	}
+	return time.Second
+}
+
+func parseWhereTimestamp(value string) (time.Time, error) {
+	for _, format := range whereTimestampFormats {
+		if timestamp, err := time.Parse(format, value); err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("where: %q is not a date", value)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareWhere(operator string, comparison int) bool {
+	switch operator {
+	case "==":
+		return comparison == 0
+	case "!=":
+		return comparison != 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	}
+	return false
+}
+
+// --------------------------------------------------------------------------------
+// Parsing
+// --------------------------------------------------------------------------------
+
+type whereParser struct {
+	tokens []whereToken
+	index  int
+}
+
+func (wp *whereParser) peek() whereToken {
+	return wp.tokens[wp.index]
+}
+
+func (wp *whereParser) next() whereToken {
+	token := wp.tokens[wp.index]
+	if token.kind != whereTokenEOF {
+		wp.index++
+	}
+	return token
+}
+
+func (wp *whereParser) parseOr() (whereNode, error) {
+	left, err := wp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for wp.peek().kind == whereTokenOperator && wp.peek().text == "||" {
+		wp.next()
+		right, err := wp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = whereOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (wp *whereParser) parseAnd() (whereNode, error) {
+	left, err := wp.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for wp.peek().kind == whereTokenOperator && wp.peek().text == "&&" {
+		wp.next()
+		right, err := wp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = whereAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (wp *whereParser) parseNot() (whereNode, error) {
+	if token := wp.peek(); token.kind == whereTokenOperator && token.text == "!" {
+		wp.next()
+		operand, err := wp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return whereNot{operand: operand}, nil
+	}
+	return wp.parseComparison()
+}
+
+func (wp *whereParser) parseComparison() (whereNode, error) {
+	if wp.peek().kind == whereTokenLeftParen {
+		wp.next()
+		node, err := wp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token := wp.next(); token.kind != whereTokenRightParen {
+			return nil, fmt.Errorf("where: expected ) at column %d", token.column)
+		}
+		return node, nil
+	}
+
+	left, err := wp.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	operator := wp.peek()
+	if operator.kind != whereTokenOperator || !isWhereComparison(operator.text) {
+		if left.kind != whereTokenTag {
+			return nil, fmt.Errorf("where: expected a comparison after %q at column %d", left.literal, operator.column)
+		}
+		return whereHasTag{tag: left.tag}, nil
+	}
+	wp.next()
+
+	right, err := wp.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	comparison := whereComparison{operator: operator.text, left: left, right: right}
+	if operator.text == "=~" {
+		if right.kind != whereTokenString {
+			return nil, fmt.Errorf("where: expected a quoted regular expression after =~ at column %d", operator.column)
+		}
+		if comparison.regex, err = regexp.Compile(right.literal); err != nil {
+			return nil, fmt.Errorf("where: invalid regular expression at column %d: %v", operator.column, err)
+		}
+	}
+	return comparison, nil
+}
+
+func (wp *whereParser) parseOperand() (whereOperand, error) {
+	token := wp.next()
+	operand := whereOperand{kind: token.kind, literal: token.text}
+	switch token.kind {
+	case whereTokenTag:
+		operand.tag = token.text
+		operand.literal = ""
+		return operand, lintWhereTag(token)
+	case whereTokenString:
+		return operand, nil
+	case whereTokenNumber:
+		if _, err := ParseRational(token.text); err != nil {
+			return operand, fmt.Errorf("where: invalid number %q at column %d", token.text, token.column)
+		}
+		return operand, nil
+	case whereTokenDate:
+		for _, format := range whereDateFormats {
+			if _, err := time.Parse(format, token.text); err == nil {
+				operand.format = format
+				return operand, nil
+			}
+		}
+		return operand, fmt.Errorf("where: invalid date %q at column %d", token.text, token.column)
+	case whereTokenEOF:
+		return operand, fmt.Errorf("where: unexpected end of expression")
+	}
+	return operand, fmt.Errorf("where: unexpected %q at column %d", token.text, token.column)
+}
+
+// lintWhereTag checks a tag as a tag of an output pattern is checked, so a
+// misspelled tag is an error rather than selecting no file.
+func lintWhereTag(token whereToken) error {
+	pattern, err := ParsePattern("{" + token.text + "}")
+	if err != nil {
+		return fmt.Errorf("where: %v at column %d", err, token.column)
+	}
+	if issues := lintPatternTags(pattern); len(issues) > 0 {
+		return fmt.Errorf("where: {%s}: %s at column %d", issues[0].Tag, issues[0].Message, token.column)
+	}
+	return nil
+}
+
+func isWhereComparison(operator string) bool {
+	switch operator {
+	case "==", "!=", "<", "<=", ">", ">=", "=~":
+		return true
+	}
+	return false
+}
+
+// --------------------------------------------------------------------------------
+// Lexing
+// --------------------------------------------------------------------------------
+
+type whereTokenKind int
+
+// where token kinds
+const (
+	whereTokenEOF whereTokenKind = iota
+	whereTokenTag
+	whereTokenString
+	whereTokenNumber
+	whereTokenDate
+	whereTokenOperator
+	whereTokenLeftParen
+	whereTokenRightParen
+)
+
+type whereToken struct {
+	kind   whereTokenKind
+	text   string
+	column int
+}
+
+var (
+	whereDateLiteral   = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(?:T\d{2}:\d{2}(?::\d{2})?)?`)
+	whereNumberLiteral = regexp.MustCompile(`^-?\d+(?:\.\d+)?(?:/\d+(?:\.\d+)?)?`)
+	whereOperators     = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!"}
+)
+
+func lexWhere(source string) ([]whereToken, error) {
+	var tokens []whereToken
+	for index := 0; index < len(source); {
+		c := rune(source[index])
+		column := index + 1
+		switch {
+		case unicode.IsSpace(c):
+			index++
+		case c == '(':
+			tokens = append(tokens, whereToken{kind: whereTokenLeftParen, text: "(", column: column})
+			index++
+		case c == ')':
+			tokens = append(tokens, whereToken{kind: whereTokenRightParen, text: ")", column: column})
+			index++
+		case c == '"':
+			value, length, err := lexWhereString(source[index:])
+			if err != nil {
+				return nil, fmt.Errorf("where: %v at column %d", err, column)
+			}
+			tokens = append(tokens, whereToken{kind: whereTokenString, text: value, column: column})
+			index += length
+		case c == '{':
+			tag, length, err := LexPatternTag(source[index:])
+			if err != nil {
+				return nil, fmt.Errorf("where: %v", columnError(err, column))
+			}
+			tokens = append(tokens, whereToken{kind: whereTokenTag, text: tag, column: column})
+			index += length
+		case whereDateLiteral.MatchString(source[index:]):
+			text := whereDateLiteral.FindString(source[index:])
+			tokens = append(tokens, whereToken{kind: whereTokenDate, text: text, column: column})
+			index += len(text)
+		case whereNumberLiteral.MatchString(source[index:]):
+			text := whereNumberLiteral.FindString(source[index:])
+			tokens = append(tokens, whereToken{kind: whereTokenNumber, text: text, column: column})
+			index += len(text)
+		case unicode.IsLetter(c) || c == '_':
+			end := index
+			for end < len(source) && (isWhereIdentifierRune(rune(source[end]))) {
+				end++
+			}
+			tokens = append(tokens, whereToken{kind: whereTokenTag, text: source[index:end], column: column})
+			index = end
+		default:
+			var matched bool
+			for _, operator := range whereOperators {
+				if strings.HasPrefix(source[index:], operator) {
+					tokens = append(tokens, whereToken{kind: whereTokenOperator, text: operator, column: column})
+					index += len(operator)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("where: unexpected %q at column %d", string(c), column)
+			}
+		}
+	}
+	return append(tokens, whereToken{kind: whereTokenEOF, column: len(source) + 1}), nil
+}
+
+func isWhereIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+// lexWhereString reads a double quoted string, in which `\"` and `\\` are
+// escapes and any other backslash is kept for regular expressions, returning
+// its value and its length in the source.
+func lexWhereString(source string) (string, int, error) {
+	var value strings.Builder
+	for index := 1; index < len(source); index++ {
+		switch source[index] {
+		case '\\':
+			if index+1 < len(source) && (source[index+1] == '"' || source[index+1] == '\\') {
+				index++
+			}
+			value.WriteByte(source[index])
+		case '"':
+			return value.String(), index + 1, nil
+		default:
+			value.WriteByte(source[index])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
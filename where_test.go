@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func whereTestMeta(cameraMake, original, iso string) *FileMetadata {
+	return &FileMetadata{
+		Path: "/photos/" + cameraMake + ".jpg",
+		Exif: ExifTags{
+			"Make":             cameraMake,
+			"Model":            "Canon EOS 5D Mark III",
+			"DateTimeOriginal": original,
+			"ISOSpeedRatings":  iso,
+			"ExposureTime":     "1/250",
+		},
+	}
+}
+
+func TestWhereMatches(t *testing.T) {
+	assert := assert.New(t)
+
+	canon := whereTestMeta("Canon", "2016:08:12 14:00:00", "3200")
+	nikon := whereTestMeta("Nikon", "2016:07:30 09:00:00", "800")
+
+	cases := []struct {
+		expression string
+		canon      bool
+		nikon      bool
+	}{
+		{`Make == "Canon" && DateTimeOriginal >= 2016-08-01 && ISOSpeedRatings > 1600`, true, false},
+		{`Make != "Canon"`, false, true},
+		{`ISOSpeedRatings >= 800 && ISOSpeedRatings < 3200`, false, true},
+		{`ExposureTime < 1/100`, true, true},
+		{`DateTimeOriginal == 2016-08-12`, true, false},
+		{`DateTimeOriginal > 2016-08-12`, false, false},
+		{`DateTimeOriginal < 2016-08-12T14:00`, false, true},
+		{`DateTimeOriginal.Year == 2016 && DateTimeOriginal.Month == "07"`, false, true},
+		{`Model =~ "5D\s+Mark"`, true, true},
+		{`!(Make == "Canon") || ISOSpeedRatings > 3000`, true, true},
+		{`GPSLatitude || Make == "Nikon"`, false, true},
+		{`!GPSLatitude`, true, true},
+		{`GPSLatitude != "0"`, false, false},
+		{`{Make|Model} == "Canon EOS 5D Mark III"`, true, true},
+	}
+	for _, testCase := range cases {
+		where, err := ParseWhere(testCase.expression)
+		assert.Nil(err, testCase.expression)
+		assert.Equal(testCase.canon, where.Matches(canon), testCase.expression)
+		assert.Equal(testCase.nikon, where.Matches(nikon), testCase.expression)
+	}
+
+	where, err := ParseWhere(`Make == "Canon"`)
+	assert.Nil(err)
+	selected := FilterWhere([]*FileMetadata{nikon, canon}, where)
+	assert.Len(selected, 1)
+	assert.Equal(canon, selected[0])
+	assert.Len(FilterWhere([]*FileMetadata{nikon, canon}, nil), 2)
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := map[string]string{
+		`Make == `:                       "where: unexpected end of expression",
+		`Make == "Canon`:                 "where: unterminated string at column 9",
+		`(Make == "Canon"`:               "where: expected ) at column 17",
+		`Make == "Canon" Model`:          `where: unexpected "Model" at column 17`,
+		`"Canon"`:                        `where: expected a comparison after "Canon" at column 8`,
+		`Make =~ Model`:                  "where: expected a quoted regular expression after =~ at column 6",
+		`Make =~ "("`:                    "where: invalid regular expression at column 6: error parsing regexp: missing closing ): `(`",
+		`Make # "Canon"`:                 `where: unexpected "#" at column 6`,
+		`DateTimeOriginal > 2016-13-01`:  `where: invalid date "2016-13-01" at column 20`,
+		`Evnt.Index == 1`:                `where: {Evnt.Index}: unknown tag "Evnt"; did you mean Event? at column 1`,
+		`Make == "Canon" && {Index x=1}`: `where: {Index x=1}: unknown attribute "x"; Index only takes scope at column 20`,
+	}
+	for expression, message := range cases {
+		_, err := ParseWhere(expression)
+		assert.NotNil(err, expression)
+		if err != nil {
+			assert.Equal(message, err.Error())
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+// +build !linux,!darwin,!freebsd,!netbsd
+
+package main
+
+// copyExtendedAttributes is a no-op on platforms without extended attribute
+// system calls.
+func copyExtendedAttributes(from, to string) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build linux || darwin || freebsd || netbsd
+// +build linux darwin freebsd netbsd
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyExtendedAttributes copies the extended attributes of a file to another
+// file. Filesystems without extended attributes are ignored, and `security.*`
+// and `trusted.*` attributes that need privileges the process doesn't have
+// are logged and skipped.
+func copyExtendedAttributes(from, to string) error {
+	size, err := unix.Listxattr(from, nil)
+	if isXattrUnsupported(err) || size == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	names := make([]byte, size)
+	if size, err = unix.Listxattr(from, names); err != nil {
+		return err
+	}
+
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		if err = copyExtendedAttribute(from, to, string(name)); err == nil || isXattrUnsupported(err) {
+			continue
+		}
+		if !isPrivilegedXattr(string(name), err) {
+			return err
+		}
+		log.Printf("%s: extended attribute %s not copied: %v", to, name, err)
+	}
+	return nil
+}
+
+func copyExtendedAttribute(from, to, name string) error {
+	size, err := unix.Getxattr(from, name, nil)
+	if err != nil {
+		return err
+	}
+	value := make([]byte, size)
+	if size, err = unix.Getxattr(from, name, value); err != nil {
+		return err
+	}
+	return unix.Setxattr(to, name, value[:size], 0)
+}
+
+func isXattrUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
+
+// isPrivilegedXattr returns if an error is a permission error for an
+// attribute in a namespace that needs privileges, which a copy can do without.
+func isPrivilegedXattr(name string, err error) bool {
+	if !strings.HasPrefix(name, "security.") && !strings.HasPrefix(name, "trusted.") {
+		return false
+	}
+	return errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES)
+}
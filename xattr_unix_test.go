@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd || netbsd
+// +build linux darwin freebsd netbsd
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestCopyExtendedAttributes(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "image-rename")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	source, target := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg")
+	assert.Nil(ioutil.WriteFile(source, []byte("a"), 0644))
+	assert.Nil(ioutil.WriteFile(target, []byte("a"), 0644))
+	if err := unix.Setxattr(source, "user.rating", []byte("5"), 0); err != nil {
+		t.Skipf("extended attributes are not supported: %v", err)
+	}
+
+	assert.Nil(copyExtendedAttributes(source, target))
+	value := make([]byte, 16)
+	size, err := unix.Getxattr(target, "user.rating", value)
+	assert.Nil(err)
+	assert.Equal("5", string(value[:size]))
+}
+
+func TestIsPrivilegedXattr(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isPrivilegedXattr("security.selinux", unix.EPERM))
+	assert.True(isPrivilegedXattr("trusted.overlay.origin", unix.EACCES))
+	assert.False(isPrivilegedXattr("user.rating", unix.EPERM))
+	assert.False(isPrivilegedXattr("security.selinux", unix.EIO))
+}